@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AccessTokenTTL is how long an access token stays valid, kept short since it can't be recalled without a DB hit
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be exchanged for a new pair
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ErrInvalidCredentials is returned for an unknown email or a wrong password.
+// Both cases share one error so callers can't leak which accounts exist.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// ErrInvalidToken is returned when a token can't be parsed, is expired or was signed with another key
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims represents the JWT claims
+type Claims struct {
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+	jwt.StandardClaims
+}
+
+// signingKey is read on every call because .env is only loaded once the DB is initialised
+func signingKey() []byte {
+	key := []byte(os.Getenv("JWT_SECRET"))
+	if len(key) == 0 {
+		key = []byte("your-secret-key") // Fallback for dev
+	}
+	return key
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashRefreshToken is what we store, so a DB leak doesn't hand out sessions
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// -------------- IssueToken signs an access token for the given user --------------
+func IssueToken(userID int64, role string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID: userID,
+		Role:   role,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(signingKey())
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %v", err)
+	}
+	return tokenString, nil
+}
+
+// -------------- ParseToken verifies a token and returns its claims --------------
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Only accept the algorithm we sign with, never "none" or RSA/HMAC confusion
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return signingKey(), nil
+	})
+	if err != nil || !token.Valid || claims.Id == "" {
+		return nil, ErrInvalidToken
+	}
+	// Tokens issued before roles existed belong to regular users
+	if claims.Role == "" {
+		claims.Role = models.RoleUser
+	}
+	return claims, nil
+}
+
+// HasRole reports whether the claims carry one of the given roles
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// -------------- IsRevoked reports whether the token was revoked by a logout --------------
+func IsRevoked(claims *Claims) (bool, error) {
+	return models.IsAccessTokenRevoked(claims.Id)
+}
+
+// -------------- IssueRefreshToken creates and stores a new refresh token --------------
+func IssueRefreshToken(userID int64) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := models.CreateRefreshToken(userID, hashRefreshToken(token), time.Now().Add(RefreshTokenTTL)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// -------------- RotateRefreshToken exchanges a refresh token for a new one --------------
+// The old token is revoked, so each refresh token can only be used once.
+func RotateRefreshToken(token string) (int64, string, error) {
+	newToken, err := randomToken(32)
+	if err != nil {
+		return 0, "", err
+	}
+
+	userID, err := models.RotateRefreshToken(hashRefreshToken(token), hashRefreshToken(newToken), time.Now().Add(RefreshTokenTTL))
+	if errors.Is(err, models.ErrRefreshTokenInvalid) {
+		return 0, "", ErrInvalidToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, newToken, nil
+}
+
+// -------------- Revoke ends a session: the access token and, if given, its refresh token --------------
+func Revoke(claims *Claims, refreshToken string) error {
+	if err := models.RevokeAccessToken(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	return models.RevokeRefreshToken(claims.UserID, hashRefreshToken(refreshToken))
+}
+
+// -------------- HashPassword bcrypt-hashes a plaintext password --------------
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
+	}
+	return string(hashed), nil
+}
+
+// isBcryptHash reports whether a stored password is already a bcrypt hash
+func isBcryptHash(stored string) bool {
+	return len(stored) == 60 &&
+		(strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$"))
+}
+
+// -------------- Authenticate checks an email and password against the users table --------------
+// Seeded users still have plaintext passwords; those are rehashed with bcrypt on
+// their first successful login so the plaintext never needs to be read again.
+func Authenticate(email, password string) (models.User, error) {
+	user, err := models.GetUserByEmail(strings.ToLower(strings.TrimSpace(email)))
+	if errors.Is(err, models.ErrNotFound) {
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if isBcryptHash(user.Password) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+			return models.User{}, ErrInvalidCredentials
+		}
+		return user, nil
+	}
+
+	// Legacy plaintext password
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err := models.UpdateUserPassword(user.ID, hashed); err != nil {
+		return models.User{}, err
+	}
+	user.Password = hashed
+
+	return user, nil
+}
@@ -0,0 +1,9 @@
+-- Let Postgres allocate user IDs for self-registered accounts.
+-- The seeded users keep their IDs; the sequence starts after the highest one.
+CREATE SEQUENCE IF NOT EXISTS users_u_id_seq OWNED BY users.u_id;
+
+ALTER TABLE users ALTER COLUMN u_id SET DEFAULT nextval('users_u_id_seq');
+
+SELECT setval('users_u_id_seq', COALESCE((SELECT MAX(u_id) FROM users), 0) + 1, false);
+
+-- bcrypt hashes are 60 characters, which fits the existing VARCHAR(255)
@@ -0,0 +1,20 @@
+-- Rotating refresh tokens, only the SHA-256 of the token is stored
+CREATE TABLE refresh_tokens (
+    rt_id SERIAL PRIMARY KEY,
+    u_id INT NOT NULL,
+    rt_hash CHAR(64) UNIQUE NOT NULL,
+    rt_expires_at TIMESTAMP NOT NULL,
+    rt_revoked_at TIMESTAMP, -- nullable, set on rotation or logout
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (u_id) REFERENCES users(u_id)
+);
+
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(u_id);
+
+-- Access tokens revoked before they expire, keyed by the JWT "jti" claim
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_tokens_expires ON revoked_tokens(expires_at);
@@ -0,0 +1,13 @@
+-- Roles for access control, every existing user starts as a regular user.
+-- Promote the first admin by hand:
+--   UPDATE users SET u_role = 'admin' WHERE u_email = 'you@example.com';
+ALTER TABLE users
+    ADD COLUMN u_role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (u_role IN ('user', 'moderator', 'admin'));
+
+-- Admins create categories through the API, so let Postgres allocate their IDs too
+CREATE SEQUENCE IF NOT EXISTS categories_c_id_seq OWNED BY categories.c_id;
+
+ALTER TABLE categories ALTER COLUMN c_id SET DEFAULT nextval('categories_c_id_seq');
+
+SELECT setval('categories_c_id_seq', COALESCE((SELECT MAX(c_id) FROM categories), 0) + 1, false);
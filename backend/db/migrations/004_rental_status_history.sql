@@ -0,0 +1,17 @@
+-- Who last changed a rental's status and when
+ALTER TABLE rentals ADD COLUMN status_changed_by INT REFERENCES users(u_id); -- nullable until the first change
+ALTER TABLE rentals ADD COLUMN status_changed_at TIMESTAMP; -- nullable until the first change
+
+-- Full audit trail of status changes, one row per transition
+CREATE TABLE rental_status_history (
+    rsh_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    changed_by INT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (rental_id) REFERENCES rentals(rental_id),
+    FOREIGN KEY (changed_by) REFERENCES users(u_id)
+);
+
+CREATE INDEX idx_rental_status_history_rental ON rental_status_history(rental_id);
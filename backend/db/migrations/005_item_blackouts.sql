@@ -0,0 +1,13 @@
+-- Owner-defined periods when an item can't be rented at all (repairs, own use, ...)
+CREATE TABLE item_blackouts (
+    b_id SERIAL PRIMARY KEY,
+    i_id INT NOT NULL,
+    start_date TIMESTAMP NOT NULL,
+    end_date TIMESTAMP NOT NULL,
+    reason TEXT, -- nullable
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date > start_date),
+    FOREIGN KEY (i_id) REFERENCES items(i_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_item_blackouts_item_dates ON item_blackouts(i_id, start_date, end_date);
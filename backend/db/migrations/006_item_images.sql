@@ -0,0 +1,26 @@
+-- Ordered photos per item. The bytes live in the configured storage backend
+-- (see storage/), this table only keeps metadata and storage keys.
+CREATE TABLE item_images (
+    img_id SERIAL PRIMARY KEY,
+    i_id INT NOT NULL,
+    position INT NOT NULL, -- 1-based display order, 1 is the cover photo
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL,
+    etag CHAR(64) NOT NULL, -- SHA-256 of the original
+    storage_key VARCHAR(255) NOT NULL,
+    thumb_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (i_id) REFERENCES items(i_id) ON DELETE CASCADE,
+    -- Deferred so positions can be shifted/reordered in a single statement
+    UNIQUE (i_id, position) DEFERRABLE INITIALLY DEFERRED
+);
+
+-- Blobs for the Postgres storage backend (IMAGE_STORAGE=postgres, the default)
+CREATE TABLE image_blobs (
+    key VARCHAR(255) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    content_type VARCHAR(50) NOT NULL
+);
+
+-- items.i_image is no longer read or written; photos go through /api/items/{id}/images
+COMMENT ON COLUMN items.i_image IS 'deprecated, replaced by item_images';
@@ -0,0 +1,18 @@
+-- Reviews belong to a completed rental, which ties them to an item and both parties.
+-- u_id stays the reviewer; seeded reviews predate rentals and keep NULL links.
+CREATE SEQUENCE IF NOT EXISTS reviews_r_id_seq OWNED BY reviews.r_id;
+
+ALTER TABLE reviews ALTER COLUMN r_id SET DEFAULT nextval('reviews_r_id_seq');
+
+SELECT setval('reviews_r_id_seq', COALESCE((SELECT MAX(r_id) FROM reviews), 0) + 1, false);
+
+ALTER TABLE reviews ADD COLUMN rental_id INT REFERENCES rentals(rental_id); -- nullable for seeded reviews
+ALTER TABLE reviews ADD COLUMN i_id INT REFERENCES items(i_id) ON DELETE SET NULL; -- nullable
+ALTER TABLE reviews ADD COLUMN reviewee_id INT REFERENCES users(u_id); -- nullable for seeded reviews
+ALTER TABLE reviews ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+-- One review per party per rental
+ALTER TABLE reviews ADD CONSTRAINT reviews_rental_reviewer_key UNIQUE (rental_id, u_id);
+
+CREATE INDEX idx_reviews_item ON reviews(i_id);
+CREATE INDEX idx_reviews_reviewee ON reviews(reviewee_id);
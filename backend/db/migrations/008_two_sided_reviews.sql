@@ -0,0 +1,16 @@
+-- Which way a review points, plus the direction-specific ratings
+ALTER TABLE reviews ADD COLUMN r_direction VARCHAR(20)
+    CHECK (r_direction IN ('renter_to_owner', 'owner_to_renter')); -- nullable for seeded reviews
+ALTER TABLE reviews ADD COLUMN item_star INT CHECK (item_star BETWEEN 1 AND 5); -- renter rating the item
+ALTER TABLE reviews ADD COLUMN condition_star INT CHECK (condition_star BETWEEN 1 AND 5); -- owner rating the returned condition
+ALTER TABLE reviews ADD COLUMN on_time BOOLEAN; -- owner: was the item returned on time
+
+-- Double-blind: a review stays hidden until the other party reviews too (published_at)
+-- or the review window closes (reveal_at). Seeded reviews have neither and are public.
+ALTER TABLE reviews ADD COLUMN reveal_at TIMESTAMP;
+ALTER TABLE reviews ADD COLUMN published_at TIMESTAMP;
+
+UPDATE reviews SET r_direction = 'renter_to_owner' WHERE rental_id IS NOT NULL AND r_direction IS NULL
+    AND u_id = (SELECT renter_id FROM rentals WHERE rentals.rental_id = reviews.rental_id);
+UPDATE reviews SET r_direction = 'owner_to_renter' WHERE rental_id IS NOT NULL AND r_direction IS NULL;
+UPDATE reviews SET published_at = created_at WHERE rental_id IS NOT NULL AND published_at IS NULL;
@@ -0,0 +1,22 @@
+-- Published review aggregates, computed on read so double-blind reveals show up
+-- without a background job. Renters' item_star wins over the overall star when given.
+CREATE VIEW item_rating_stats AS
+SELECT
+    rv.i_id,
+    AVG(COALESCE(rv.item_star, rv.r_star))::FLOAT8 AS rating,
+    COUNT(*) AS review_count
+FROM reviews rv
+WHERE rv.i_id IS NOT NULL
+AND (rv.r_direction IS NULL OR rv.r_direction = 'renter_to_owner')
+AND (rv.published_at IS NOT NULL OR rv.reveal_at IS NULL OR rv.reveal_at <= CURRENT_TIMESTAMP)
+GROUP BY rv.i_id;
+
+CREATE VIEW owner_rating_stats AS
+SELECT
+    rv.reviewee_id AS owner_id,
+    AVG(rv.r_star)::FLOAT8 AS rating,
+    COUNT(*) AS review_count
+FROM reviews rv
+WHERE rv.r_direction = 'renter_to_owner'
+AND (rv.published_at IS NOT NULL OR rv.reveal_at IS NULL OR rv.reveal_at <= CURRENT_TIMESTAMP)
+GROUP BY rv.reviewee_id;
@@ -0,0 +1,23 @@
+-- Ledger entries posted by the rental lifecycle. Amounts are positive cents, t_type says
+-- which way the money moves. Platform fee rows have no user.
+CREATE SEQUENCE IF NOT EXISTS transactions_t_id_seq OWNED BY transactions.t_id;
+
+ALTER TABLE transactions ALTER COLUMN t_id SET DEFAULT nextval('transactions_t_id_seq');
+
+SELECT setval('transactions_t_id_seq', COALESCE((SELECT MAX(t_id) FROM transactions), 0) + 1, false);
+
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'Charge';
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'Payout';
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'Fee';
+
+ALTER TABLE transactions ALTER COLUMN u_id DROP NOT NULL; -- NULL for the platform's own entries
+ALTER TABLE transactions ALTER COLUMN t_date SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE transactions ADD COLUMN rental_id INT REFERENCES rentals(rental_id); -- nullable for seeded rows
+
+CREATE INDEX idx_transactions_user ON transactions(u_id, t_date DESC);
+CREATE INDEX idx_transactions_rental ON transactions(rental_id);
+
+-- The fee is fixed when the rental is requested so later fee changes don't move old payouts.
+-- Existing rentals were priced without a fee, so they keep 0 and their owners get the full total.
+ALTER TABLE rentals ADD COLUMN service_fee INT NOT NULL DEFAULT 0;
+
@@ -0,0 +1,4 @@
+-- Provider IDs for rental payments. The payment is authorized on approval and captured on completion.
+ALTER TABLE rentals ADD COLUMN payment_id VARCHAR(100); -- NULL until approved, or for free rentals
+
+ALTER TABLE transactions ADD COLUMN t_reference VARCHAR(100); -- provider payment or payout ID, nullable
@@ -0,0 +1,40 @@
+-- Refundable security deposits. The item sets the amount, the rental keeps its own copy so
+-- later edits to the item don't change deposits that are already held.
+ALTER TABLE items ADD COLUMN i_deposit INT NOT NULL DEFAULT 0 CHECK (i_deposit >= 0);
+
+ALTER TABLE rentals ADD COLUMN deposit INT NOT NULL DEFAULT 0;
+ALTER TABLE rentals ADD COLUMN deposit_payment_id VARCHAR(100); -- NULL until the hold is placed
+ALTER TABLE rentals ADD COLUMN deposit_status VARCHAR(20) NOT NULL DEFAULT 'none'
+    CHECK (deposit_status IN ('none', 'held', 'released', 'claimed'));
+
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'DepositHold';
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'DepositRelease';
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'DepositCapture';
+
+-- One damage claim per rental, filed by the owner against the held deposit
+CREATE TABLE damage_claims (
+    dc_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL UNIQUE REFERENCES rentals(rental_id),
+    amount INT NOT NULL CHECK (amount > 0), -- what the owner asks for, at most the deposit
+    description TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'accepted', 'contested', 'resolved')),
+    renter_response TEXT,
+    responded_at TIMESTAMP,
+    captured_amount INT, -- what was finally taken from the deposit
+    resolved_by INT REFERENCES users(u_id),
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Evidence photos, stored like item photos (see storage/)
+CREATE TABLE damage_claim_evidence (
+    ev_id SERIAL PRIMARY KEY,
+    dc_id INT NOT NULL REFERENCES damage_claims(dc_id) ON DELETE CASCADE,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_damage_claim_evidence_claim ON damage_claim_evidence(dc_id);
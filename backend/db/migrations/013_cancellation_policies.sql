@@ -0,0 +1,8 @@
+-- Per-item cancellation policy, copied onto the rental when it is requested so an owner
+-- tightening the policy later doesn't change what existing renters get back.
+ALTER TABLE items ADD COLUMN i_cancellation_policy VARCHAR(20) NOT NULL DEFAULT 'flexible'
+    CHECK (i_cancellation_policy IN ('flexible', 'moderate', 'strict'));
+
+ALTER TABLE rentals ADD COLUMN cancellation_policy VARCHAR(20) NOT NULL DEFAULT 'flexible'
+    CHECK (cancellation_policy IN ('flexible', 'moderate', 'strict'));
+ALTER TABLE rentals ADD COLUMN refund_amount INT; -- set when an approved rental is cancelled
@@ -0,0 +1,31 @@
+-- Checkout (pickup) and checkin (return) records. A rental is active between the two.
+ALTER TABLE rentals DROP CONSTRAINT IF EXISTS rentals_status_check;
+ALTER TABLE rentals ADD CONSTRAINT rentals_status_check
+    CHECK (status IN ('pending', 'approved', 'active', 'rejected', 'completed', 'cancelled'));
+
+-- One report per rental and kind, confirmed by each party on their own
+CREATE TABLE handover_reports (
+    hr_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL REFERENCES rentals(rental_id),
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('checkout', 'checkin')),
+    owner_confirmed_at TIMESTAMP,
+    renter_confirmed_at TIMESTAMP,
+    owner_notes TEXT,
+    renter_notes TEXT,
+    completed_at TIMESTAMP, -- when the second party confirmed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (rental_id, kind)
+);
+
+-- Condition photos, stored like item photos (see storage/)
+CREATE TABLE handover_photos (
+    hp_id SERIAL PRIMARY KEY,
+    hr_id INT NOT NULL REFERENCES handover_reports(hr_id) ON DELETE CASCADE,
+    uploaded_by INT NOT NULL REFERENCES users(u_id),
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_handover_photos_report ON handover_photos(hr_id);
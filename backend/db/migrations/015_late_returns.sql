@@ -0,0 +1,28 @@
+-- Late returns. The per-day late fee defaults to the daily price and is copied onto the
+-- rental when it is requested, like the deposit and cancellation policy.
+ALTER TABLE items ADD COLUMN i_late_fee INT CHECK (i_late_fee >= 0); -- NULL charges i_price
+
+ALTER TABLE rentals ADD COLUMN late_fee_per_day INT NOT NULL DEFAULT 0;
+ALTER TABLE rentals ADD COLUMN overdue_at TIMESTAMP; -- set when the job first flags the rental
+ALTER TABLE rentals ADD COLUMN late_days INT NOT NULL DEFAULT 0; -- started days charged so far
+
+UPDATE rentals r SET late_fee_per_day = i.i_price FROM items i WHERE r.item_id = i.i_id;
+
+CREATE INDEX idx_rentals_status_end ON rentals(status, end_date);
+
+ALTER TYPE transaction_type ADD VALUE IF NOT EXISTS 'LateFee';
+
+-- In-app notifications
+CREATE TABLE notifications (
+    n_id SERIAL PRIMARY KEY,
+    u_id INT NOT NULL,
+    kind VARCHAR(40) NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    body TEXT NOT NULL,
+    rental_id INT REFERENCES rentals(rental_id), -- nullable
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP, -- NULL while unread
+    FOREIGN KEY (u_id) REFERENCES users(u_id)
+);
+
+CREATE INDEX idx_notifications_user ON notifications(u_id, created_at DESC);
@@ -0,0 +1,22 @@
+-- Renters asking to keep an approved or active rental longer. The owner decides; an approved
+-- extension moves rentals.end_date and adds extra_price to the total.
+CREATE TABLE rental_extensions (
+    re_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL REFERENCES rentals(rental_id),
+    requested_by INT NOT NULL REFERENCES users(u_id),
+    previous_end_date TIMESTAMP NOT NULL,
+    new_end_date TIMESTAMP NOT NULL,
+    extra_price INT NOT NULL, -- incremental total, service fee included
+    extra_service_fee INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    decided_by INT REFERENCES users(u_id),
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (new_end_date > previous_end_date)
+);
+
+CREATE INDEX idx_rental_extensions_rental ON rental_extensions(rental_id);
+
+-- At most one extension waiting on the owner per rental
+CREATE UNIQUE INDEX idx_rental_extensions_pending ON rental_extensions(rental_id) WHERE status = 'pending';
@@ -0,0 +1,50 @@
+-- Disputes about a rental, opened by either party and ruled on by a moderator. Unlike damage
+-- claims they settle the rental payment, not the deposit.
+CREATE TABLE disputes (
+    d_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL REFERENCES rentals(rental_id),
+    opened_by INT NOT NULL REFERENCES users(u_id),
+    reason VARCHAR(30) NOT NULL
+        CHECK (reason IN ('not_as_described', 'damaged', 'no_show', 'late_return', 'other')),
+    description TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'responded', 'resolved')),
+    response TEXT, -- the other party's side
+    responded_at TIMESTAMP,
+    ruling VARCHAR(20) CHECK (ruling IN ('refund', 'partial_capture', 'no_action')),
+    refund_amount INT, -- what the ruling gave back to the renter
+    ruling_notes TEXT,
+    resolved_by INT REFERENCES users(u_id),
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_disputes_rental ON disputes(rental_id);
+
+-- One undecided dispute per rental
+CREATE UNIQUE INDEX idx_disputes_unresolved ON disputes(rental_id) WHERE status <> 'resolved';
+
+-- Evidence photos from either party, stored like item photos (see storage/)
+CREATE TABLE dispute_evidence (
+    de_id SERIAL PRIMARY KEY,
+    d_id INT NOT NULL REFERENCES disputes(d_id) ON DELETE CASCADE,
+    uploaded_by INT NOT NULL REFERENCES users(u_id),
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_dispute_evidence_dispute ON dispute_evidence(d_id);
+
+-- Every step of a dispute, in order
+CREATE TABLE dispute_events (
+    dev_id SERIAL PRIMARY KEY,
+    d_id INT NOT NULL REFERENCES disputes(d_id) ON DELETE CASCADE,
+    actor_id INT NOT NULL REFERENCES users(u_id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('opened', 'evidence', 'responded', 'resolved')),
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_dispute_events_dispute ON dispute_events(d_id, created_at);
@@ -0,0 +1,31 @@
+-- Conversations between an item's owner and a renter, either about an item before booking
+-- or about a rental. The two participants are copied from items.owner_id and rentals.renter_id
+-- (or the user asking about the item) when the thread is started.
+CREATE TABLE conversations (
+    c_id SERIAL PRIMARY KEY,
+    item_id INT NOT NULL REFERENCES items(i_id) ON DELETE CASCADE,
+    rental_id INT REFERENCES rentals(rental_id), -- NULL for questions about the item
+    owner_id INT NOT NULL REFERENCES users(u_id),
+    renter_id INT NOT NULL REFERENCES users(u_id),
+    last_message_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (owner_id <> renter_id)
+);
+
+-- One thread per rental, and one per item and interested user
+CREATE UNIQUE INDEX idx_conversations_rental ON conversations(rental_id) WHERE rental_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_conversations_item_renter ON conversations(item_id, renter_id) WHERE rental_id IS NULL;
+CREATE INDEX idx_conversations_owner ON conversations(owner_id, last_message_at DESC);
+CREATE INDEX idx_conversations_renter ON conversations(renter_id, last_message_at DESC);
+
+CREATE TABLE messages (
+    m_id SERIAL PRIMARY KEY,
+    c_id INT NOT NULL REFERENCES conversations(c_id) ON DELETE CASCADE,
+    sender_id INT NOT NULL REFERENCES users(u_id),
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP -- set when the other participant reads it
+);
+
+CREATE INDEX idx_messages_conversation ON messages(c_id, m_id DESC);
+CREATE INDEX idx_messages_unread ON messages(c_id, sender_id) WHERE read_at IS NULL;
@@ -0,0 +1,22 @@
+-- Outbox of notification deliveries. Rows are written in the same transaction as the
+-- notification (and the change it tells about), one per delivery channel, and worked off
+-- by the dispatcher. A claimed row's next_attempt_at is pushed out as a lease, so a
+-- dispatcher that dies mid-send only delays the retry.
+CREATE TABLE notification_outbox (
+    o_id SERIAL PRIMARY KEY,
+    n_id INT NOT NULL REFERENCES notifications(n_id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL, -- inapp, email or webhook
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    failed_at TIMESTAMP, -- set when the retries are used up
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (n_id, channel)
+);
+
+CREATE INDEX idx_notification_outbox_due ON notification_outbox(next_attempt_at)
+    WHERE delivered_at IS NULL AND failed_at IS NULL;
+
+-- Unread badge and inbox paging
+CREATE INDEX idx_notifications_unread ON notifications(u_id) WHERE read_at IS NULL;
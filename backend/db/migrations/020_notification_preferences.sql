@@ -0,0 +1,23 @@
+-- How each user wants to hear about each kind of notification. Kinds without a row
+-- are delivered immediately.
+CREATE TABLE notification_preferences (
+    u_id INT NOT NULL REFERENCES users(u_id) ON DELETE CASCADE,
+    kind VARCHAR(40) NOT NULL,
+    delivery VARCHAR(10) NOT NULL CHECK (delivery IN ('immediate', 'digest', 'inapp', 'off')),
+    PRIMARY KEY (u_id, kind)
+);
+
+-- Time zone and quiet hours, which are wall clock times in that zone
+CREATE TABLE notification_settings (
+    u_id INT PRIMARY KEY REFERENCES users(u_id) ON DELETE CASCADE,
+    time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    quiet_start TIME, -- NULL for no quiet hours
+    quiet_end TIME,
+    last_digest_on DATE, -- the user's local date of the last digest email
+    CHECK ((quiet_start IS NULL) = (quiet_end IS NULL))
+);
+
+-- Notifications waiting for the user's next digest email
+ALTER TABLE notifications ADD COLUMN digest_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_notifications_digest ON notifications(u_id) WHERE digest_pending;
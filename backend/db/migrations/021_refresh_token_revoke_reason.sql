@@ -0,0 +1,5 @@
+-- Why a refresh token stopped working. Only presenting a "rotated" token again counts as
+-- reuse; a token ended by logout is simply invalid. Tokens revoked before this column
+-- existed keep NULL and are treated like logouts.
+ALTER TABLE refresh_tokens ADD COLUMN rt_revoked_reason VARCHAR(10)
+    CHECK (rt_revoked_reason IN ('rotated', 'logout', 'reuse'));
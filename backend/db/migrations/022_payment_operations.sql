@@ -0,0 +1,28 @@
+-- Charges, captures, releases and payouts waiting to be sent to the payment provider. Rows
+-- are written in the same transaction as the ledger entries that book them and sent after the
+-- commit, so a rolled back change never moves money. reference is the idempotency key sent
+-- along, one per rental and step (e.g. rental-12-capture), so a retry after a crash can't
+-- move the money twice. A rental's operations run in order; one that failed for good holds
+-- back the rest until someone sorts it out. Claimed rows are leased like notification_outbox
+-- rows.
+CREATE TABLE payment_operations (
+    po_id SERIAL PRIMARY KEY,
+    rental_id INT NOT NULL REFERENCES rentals(rental_id),
+    kind VARCHAR(20) NOT NULL, -- charge, capture, release or payout
+    payment_id VARCHAR(100), -- payment captured or released, NULL for charges and payouts
+    account_id INT REFERENCES users(u_id), -- user charged or paid out, NULL for captures and releases
+    amount INT NOT NULL,
+    reference VARCHAR(100) NOT NULL UNIQUE,
+    t_id INT REFERENCES transactions(t_id), -- Payout ledger entry that gets the payout ID
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    done_at TIMESTAMP,
+    failed_at TIMESTAMP, -- set when the provider declined or the retries are used up
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payment_operations_due ON payment_operations(next_attempt_at)
+    WHERE done_at IS NULL AND failed_at IS NULL;
+CREATE INDEX idx_payment_operations_rental ON payment_operations(rental_id, po_id)
+    WHERE done_at IS NULL;
@@ -0,0 +1,8 @@
+-- A login starts a family of refresh tokens that rotation carries on, one per device or
+-- session. Reusing a rotated token only revokes its own family. Existing tokens each get a
+-- family of their own.
+CREATE SEQUENCE refresh_token_families_seq;
+
+ALTER TABLE refresh_tokens ADD COLUMN rt_family BIGINT NOT NULL DEFAULT nextval('refresh_token_families_seq');
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(rt_family);
@@ -117,21 +117,21 @@ WHERE t_id = $3
 RETURNING t_id;
 
 ------------ Review Queries ------------
--- Create review
-INSERT INTO reviews (r_id, r_comment, r_star, u_id)
-VALUES ($1, $2, $3, $4)
+-- Create review of a completed rental
+INSERT INTO reviews (r_comment, r_star, u_id, reviewee_id, rental_id, i_id)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING r_id;
 
 -- Get item reviews
-SELECT r_id, r_comment, r_star, u_id 
+SELECT r_id, r_comment, r_star, u_id, reviewee_id, rental_id, created_at
 FROM reviews 
 WHERE i_id = $1
 ORDER BY r_id DESC;
 
--- Get user reviews
-SELECT r_id, r_comment, r_star, i_id 
+-- Get reviews a user received
+SELECT r_id, r_comment, r_star, u_id, rental_id, i_id, created_at
 FROM reviews 
-WHERE u_id = $1
+WHERE reviewee_id = $1
 ORDER BY r_id DESC;
 
 -- Update review
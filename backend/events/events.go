@@ -0,0 +1,52 @@
+package events
+
+import (
+	"fmt"
+	"os"
+)
+
+// Event types pushed to connected users
+const (
+	RentalStatus        = "rental.status"        // a rental the user is a party to changed status, Data is the rental
+	RentalRequested     = "rental.requested"     // someone asked to rent one of the user's items, Data is the request
+	MessageCreated      = "message.created"      // a message in one of the user's conversations, Data is the message
+	MessagesRead        = "messages.read"        // the other participant read the user's messages, Data is a ReadReceipt
+	NotificationCreated = "notification.created" // a new notification for the user, Data is the notification
+)
+
+// Event is one update for one user. Data is sent as JSON.
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// ReadReceipt tells a sender that their messages in a conversation were read
+type ReadReceipt struct {
+	ConversationID int64 `json:"conversation_id"`
+	ReaderID       int64 `json:"reader_id"`
+	Count          int64 `json:"count"`
+}
+
+// Broker delivers events to the users they are addressed to. Publishing never blocks the
+// caller; a subscriber that falls behind loses events and should refetch what it shows.
+type Broker interface {
+	// Publish sends e to every open subscription of the given users
+	Publish(e Event, userIDs ...int64)
+	// Subscribe returns a channel of the user's events and a func to close it again
+	Subscribe(userID int64) (<-chan Event, func())
+}
+
+// Default is the broker used by the API, set up by InitBroker
+var Default Broker
+
+// InitBroker picks the broker from EVENT_BROKER. Only "memory" (the default) exists so far,
+// which only reaches users connected to the same instance.
+func InitBroker() error {
+	switch broker := os.Getenv("EVENT_BROKER"); broker {
+	case "", "memory":
+		Default = NewHub()
+	default:
+		return fmt.Errorf("unknown EVENT_BROKER %q", broker)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package events
+
+import "sync"
+
+// subscriptionBuffer is how many events a subscriber can fall behind before losing some
+const subscriptionBuffer = 32
+
+// Hub is an in-process Broker. It only knows about subscribers of this instance.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[int64]map[chan Event]struct{})}
+}
+
+func (h *Hub) Publish(e Event, userIDs ...int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		for ch := range h.subscribers[userID] {
+			select {
+			case ch <- e:
+			default: // full, drop rather than hold up the publisher
+			}
+		}
+	}
+}
+
+func (h *Hub) Subscribe(userID int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriptionBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// Longest window the availability calendar will return at once
+const maxAvailabilityWindow = 366 * 24 * time.Hour
+
+// -------------- Get an item's availability calendar --------------
+func GetItemAvailability(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	// Defaults to the next 90 days
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	to := from.Add(90 * 24 * time.Hour)
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = parseDate(value); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = parseDate(value); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxAvailabilityWindow {
+		http.Error(w, "to must be after from and at most a year later", http.StatusBadRequest)
+		return
+	}
+
+	availability, err := models.GetItemAvailability(id, from, to)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve availability", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(availability)
+}
+
+// -------------- Block out dates on an item (owner only) --------------
+func CreateBlackout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItemOwner(w, r, id) {
+		return
+	}
+
+	var blackout models.Blackout
+	if err := json.NewDecoder(r.Body).Decode(&blackout); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	blackout.ItemID = id
+	userID, _ := middleware.GetUserIDFromContext(r)
+
+	if err := models.CreateBlackout(&blackout, userID); err != nil {
+		if writeOverlapError(w, err) {
+			return
+		}
+		if errors.Is(err, models.ErrInvalidDates) {
+			http.Error(w, "End date must be after start date", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to create blackout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(blackout)
+}
+
+// -------------- Remove a blackout from an item (owner only) --------------
+func DeleteBlackout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	blackoutID, err := strconv.ParseInt(vars["blackoutId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid blackout ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItemOwner(w, r, id) {
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r)
+	isDeleted, err := models.DeleteBlackout(id, blackoutID, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete blackout", http.StatusInternalServerError)
+		return
+	}
+	if !isDeleted {
+		http.Error(w, "Blackout not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Blackout successfully deleted",
+	})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/LuaanNguyen/backend/storage"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Owner files a damage claim against the rental's deposit --------------
+func CreateDamageClaim(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claim, err := models.CreateDamageClaim(rentalID, userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidClaim):
+			http.Error(w, "A claim needs a description and an amount between 1 and the deposit", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Rental not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrForbidden):
+			http.Error(w, "Only the owner can file a damage claim", http.StatusForbidden)
+		case errors.Is(err, models.ErrIllegalTransition):
+			http.Error(w, "Damage claims can only be filed between the checkout and the checkin", http.StatusConflict)
+		case errors.Is(err, models.ErrNoDeposit):
+			http.Error(w, "Rental has no deposit held", http.StatusConflict)
+		case errors.Is(err, models.ErrClaimExists):
+			http.Error(w, "Rental already has a damage claim", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to create damage claim", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(claim)
+}
+
+// loadClaim fetches the claim and lets only its parties and moderators through
+func loadClaim(w http.ResponseWriter, r *http.Request) (models.DamageClaim, bool) {
+	claimID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid claim ID", http.StatusBadRequest)
+		return models.DamageClaim{}, false
+	}
+
+	claim, err := models.GetDamageClaim(claimID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Damage claim not found", http.StatusNotFound)
+			return models.DamageClaim{}, false
+		}
+		http.Error(w, "Failed to retrieve damage claim", http.StatusInternalServerError)
+		return models.DamageClaim{}, false
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return models.DamageClaim{}, false
+	}
+	if userID != claim.OwnerID && userID != claim.RenterID && !middleware.HasRole(r, models.RoleModerator, models.RoleAdmin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return models.DamageClaim{}, false
+	}
+	return claim, true
+}
+
+// -------------- Get a damage claim (parties and moderators) --------------
+func GetDamageClaim(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claim, ok := loadClaim(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(claim)
+}
+
+// -------------- List damage claims, ?status=contested for the moderation queue --------------
+func GetDamageClaims(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.ValidClaimStatus(status) {
+		http.Error(w, "Invalid status filter", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := models.GetDamageClaims(status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve damage claims", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(claims)
+}
+
+// -------------- Owner uploads evidence photos while the claim is open --------------
+func UploadClaimEvidence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claim, ok := loadClaim(w, r)
+	if !ok {
+		return
+	}
+	if !authorizeOwner(w, r, claim.OwnerID) {
+		return
+	}
+
+	uploads, ok := readUploads(w, r, models.MaxClaimEvidence)
+	if !ok {
+		return
+	}
+
+	// Store every photo first and record them together, a failure leaves nothing behind
+	evidence := []models.ClaimEvidence{}
+	var keys []string
+	for _, u := range uploads {
+		key, err := storage.NewKey(fmt.Sprintf("claims/%d", claim.ID))
+		if err == nil {
+			err = storage.Default.Put(key, u.data, u.contentType)
+		}
+		if err != nil {
+			deleteStoredImage(keys...)
+			http.Error(w, "Failed to store evidence", http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, key)
+		evidence = append(evidence, models.ClaimEvidence{
+			ClaimID:     claim.ID,
+			ContentType: u.contentType,
+			Size:        len(u.data),
+			StorageKey:  key,
+		})
+	}
+
+	if err := models.AddClaimEvidence(evidence); err != nil {
+		deleteStoredImage(keys...)
+		switch {
+		case errors.Is(err, models.ErrTooMuchEvidence):
+			http.Error(w, fmt.Sprintf("A claim can have at most %d evidence photos", models.MaxClaimEvidence), http.StatusConflict)
+		case errors.Is(err, models.ErrClaimClosed):
+			http.Error(w, "Evidence can only be added while the claim is open", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to store evidence", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(evidence)
+}
+
+// -------------- Stream an evidence photo (parties and moderators) --------------
+func ServeClaimEvidence(w http.ResponseWriter, r *http.Request) {
+	claim, ok := loadClaim(w, r)
+	if !ok {
+		return
+	}
+
+	evidenceID, err := strconv.ParseInt(mux.Vars(r)["evidenceId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid evidence ID", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := models.GetClaimEvidence(claim.ID, evidenceID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Evidence not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve evidence", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := storage.Default.Get(ev.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Evidence not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve evidence", http.StatusInternalServerError)
+		return
+	}
+
+	// Evidence never changes once uploaded, but it is private to the claim
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("Content-Type", ev.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", ev.CreatedAt.Truncate(time.Second), bytes.NewReader(data))
+}
+
+// -------------- Renter accepts or contests a damage claim --------------
+func RespondToDamageClaim(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claimID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid claim ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ClaimResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claim, err := models.RespondToDamageClaim(claimID, userID, req)
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(claim)
+}
+
+// -------------- Moderator rules on a damage claim --------------
+func ResolveDamageClaim(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claimID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid claim ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ClaimResolutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claim, err := models.ResolveDamageClaim(claimID, userID, req)
+	if errors.Is(err, models.ErrForbidden) {
+		http.Error(w, "Moderators can't resolve claims on their own rentals", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		writeClaimError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(claim)
+}
+
+func writeClaimError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidClaim):
+		http.Error(w, "Amount must be between 0 and the claimed amount", http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Damage claim not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "Only the renter can respond to a damage claim", http.StatusForbidden)
+	case errors.Is(err, models.ErrClaimClosed):
+		http.Error(w, "Damage claim is already settled", http.StatusConflict)
+	case errors.Is(err, models.ErrPaymentDeclined):
+		http.Error(w, "Payment was declined", http.StatusPaymentRequired)
+	default:
+		http.Error(w, "Failed to update damage claim", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Start a conversation about an item or a rental --------------
+// Answers 201 for a new thread and 200 with the existing one otherwise.
+func StartConversation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conversation, created, err := models.StartConversation(userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidConversation):
+			http.Error(w, "Send either an item_id or a rental_id", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Item or rental not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrForbidden):
+			http.Error(w, "You can't message yourself, or you're not a party to the rental", http.StatusForbidden)
+		default:
+			http.Error(w, "Failed to start conversation", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// -------------- Get the current user's conversations --------------
+func GetConversations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversations, err := models.GetConversations(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve conversations", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// -------------- Count the current user's unread messages --------------
+func GetUnreadMessageCount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := models.GetUnreadMessageCount(userID)
+	if err != nil {
+		http.Error(w, "Failed to count unread messages", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"unread": count})
+}
+
+// conversationRequest reads the conversation ID and the current user, answering the error itself
+func conversationRequest(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	return id, userID, true
+}
+
+// -------------- Get a conversation (participants only) --------------
+func GetConversation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, userID, ok := conversationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	conversation, err := models.GetConversation(id, userID)
+	if err != nil {
+		writeConversationError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// -------------- Get a page of messages, newest first: ?before=<message id>&limit=50 --------------
+func GetMessages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, userID, ok := conversationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var before int64
+	if value := r.URL.Query().Get("before"); value != "" {
+		var err error
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before < 1 {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := models.DefaultMessagePage
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxMessagePage {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", models.MaxMessagePage), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := models.GetMessages(id, userID, before, limit)
+	if err != nil {
+		writeConversationError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// -------------- Send a message --------------
+func SendMessage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, userID, ok := conversationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.MessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := models.SendMessage(id, userID, req.Body)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidMessage) {
+			http.Error(w, fmt.Sprintf("A message needs between 1 and %d characters", models.MaxMessageLength), http.StatusBadRequest)
+			return
+		}
+		writeConversationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// -------------- Mark the other participant's messages as read --------------
+func MarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, userID, ok := conversationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	read, err := models.MarkConversationRead(id, userID)
+	if err != nil {
+		writeConversationError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{"read": read})
+}
+
+func writeConversationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "Only the participants can see a conversation", http.StatusForbidden)
+	default:
+		http.Error(w, "Failed to process conversation", http.StatusInternalServerError)
+	}
+}
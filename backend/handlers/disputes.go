@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/LuaanNguyen/backend/storage"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Either party opens a dispute on a rental --------------
+func OpenDispute(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dispute, err := models.OpenDispute(rentalID, userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidDispute):
+			http.Error(w, "A dispute needs a known reason and a description", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Rental not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrForbidden):
+			http.Error(w, "Only the parties to a rental can open a dispute", http.StatusForbidden)
+		case errors.Is(err, models.ErrIllegalTransition):
+			http.Error(w, "Disputes can only be opened on approved or active rentals", http.StatusConflict)
+		case errors.Is(err, models.ErrDisputeExists):
+			http.Error(w, "Rental already has an open dispute", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to open dispute", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dispute)
+}
+
+// -------------- Get a rental's disputes (parties and moderators) --------------
+func GetRentalDisputes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeRentalParty(w, r, rentalID) {
+		return
+	}
+
+	disputes, err := models.GetDisputes(rentalID, "")
+	if err != nil {
+		http.Error(w, "Failed to retrieve disputes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(disputes)
+}
+
+// loadDispute fetches the dispute and lets only its parties and moderators through
+func loadDispute(w http.ResponseWriter, r *http.Request) (models.Dispute, bool) {
+	disputeID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dispute ID", http.StatusBadRequest)
+		return models.Dispute{}, false
+	}
+
+	dispute, err := models.GetDispute(disputeID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Dispute not found", http.StatusNotFound)
+			return models.Dispute{}, false
+		}
+		http.Error(w, "Failed to retrieve dispute", http.StatusInternalServerError)
+		return models.Dispute{}, false
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return models.Dispute{}, false
+	}
+	if userID != dispute.OwnerID && userID != dispute.RenterID && !middleware.HasRole(r, models.RoleModerator, models.RoleAdmin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return models.Dispute{}, false
+	}
+	return dispute, true
+}
+
+// -------------- Get a dispute with its evidence and history (parties and moderators) --------------
+func GetDispute(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	dispute, ok := loadDispute(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(dispute)
+}
+
+// -------------- List disputes, ?status=responded for the moderation queue --------------
+func GetDisputes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.ValidDisputeStatus(status) {
+		http.Error(w, "Invalid status filter", http.StatusBadRequest)
+		return
+	}
+
+	disputes, err := models.GetDisputes(0, status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve disputes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(disputes)
+}
+
+// -------------- Either party uploads evidence photos until the dispute is resolved --------------
+func UploadDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	dispute, ok := loadDispute(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserIDFromContext(r)
+	if userID != dispute.OwnerID && userID != dispute.RenterID {
+		http.Error(w, "Only the parties can add evidence", http.StatusForbidden)
+		return
+	}
+
+	uploads, ok := readUploads(w, r, models.MaxDisputeEvidence)
+	if !ok {
+		return
+	}
+
+	// Store every photo first and record them together, a failure leaves nothing behind
+	evidence := []models.DisputeEvidence{}
+	var keys []string
+	for _, u := range uploads {
+		key, err := storage.NewKey(fmt.Sprintf("disputes/%d", dispute.ID))
+		if err == nil {
+			err = storage.Default.Put(key, u.data, u.contentType)
+		}
+		if err != nil {
+			deleteStoredImage(keys...)
+			http.Error(w, "Failed to store evidence", http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, key)
+		evidence = append(evidence, models.DisputeEvidence{
+			DisputeID:   dispute.ID,
+			UploadedBy:  userID,
+			ContentType: u.contentType,
+			Size:        len(u.data),
+			StorageKey:  key,
+		})
+	}
+
+	if err := models.AddDisputeEvidence(evidence); err != nil {
+		deleteStoredImage(keys...)
+		switch {
+		case errors.Is(err, models.ErrTooMuchDisputeEvidence):
+			http.Error(w, fmt.Sprintf("A dispute can have at most %d evidence photos", models.MaxDisputeEvidence), http.StatusConflict)
+		case errors.Is(err, models.ErrDisputeClosed):
+			http.Error(w, "Evidence can only be added until the dispute is resolved", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to store evidence", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(evidence)
+}
+
+// -------------- Stream a dispute evidence photo (parties and moderators) --------------
+func ServeDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	dispute, ok := loadDispute(w, r)
+	if !ok {
+		return
+	}
+
+	evidenceID, err := strconv.ParseInt(mux.Vars(r)["evidenceId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid evidence ID", http.StatusBadRequest)
+		return
+	}
+
+	ev, err := models.GetDisputeEvidence(dispute.ID, evidenceID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Evidence not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve evidence", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := storage.Default.Get(ev.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Evidence not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve evidence", http.StatusInternalServerError)
+		return
+	}
+
+	// Evidence never changes once uploaded, but it is private to the dispute
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("Content-Type", ev.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", ev.CreatedAt.Truncate(time.Second), bytes.NewReader(data))
+}
+
+// -------------- The other party responds to a dispute --------------
+func RespondToDispute(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	disputeID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dispute ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DisputeResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dispute, err := models.RespondToDispute(disputeID, userID, req)
+	if err != nil {
+		writeDisputeError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(dispute)
+}
+
+// -------------- Moderator rules on a dispute --------------
+func ResolveDispute(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	disputeID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dispute ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DisputeRulingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	dispute, err := models.ResolveDispute(disputeID, userID, req)
+	if errors.Is(err, models.ErrForbidden) {
+		http.Error(w, "Moderators can't rule on disputes about their own rentals", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		writeDisputeError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(dispute)
+}
+
+func writeDisputeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidDispute):
+		http.Error(w, "A response can't be empty", http.StatusBadRequest)
+	case errors.Is(err, models.ErrInvalidRuling):
+		http.Error(w, "Ruling must be refund, partial_capture with an amount between 0 and the total, or no_action", http.StatusBadRequest)
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Dispute not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "Only the other party can respond to a dispute", http.StatusForbidden)
+	case errors.Is(err, models.ErrDisputeClosed):
+		http.Error(w, "Dispute is no longer waiting on that step", http.StatusConflict)
+	case errors.Is(err, models.ErrPaymentDeclined):
+		http.Error(w, "Payment was declined", http.StatusPaymentRequired)
+	default:
+		http.Error(w, "Failed to update dispute", http.StatusInternalServerError)
+	}
+}
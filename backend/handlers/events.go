@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LuaanNguyen/backend/events"
+	"github.com/LuaanNguyen/backend/middleware"
+)
+
+// heartbeatInterval keeps proxies from closing an idle stream
+const heartbeatInterval = 25 * time.Second
+
+// -------------- Stream the current user's live updates as server-sent events --------------
+// The stream ends when the access token expires; EventSource then reconnects, and the
+// client should pass a fresh token. Events missed while disconnected are not replayed.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	claims, err := middleware.GetClaimsFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the stream
+
+	stream, unsubscribe := events.Default.Subscribe(claims.UserID)
+	defer unsubscribe()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	expired := time.NewTimer(time.Until(time.Unix(claims.ExpiresAt, 0)))
+	defer expired.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired.C:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, ok := <-stream:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				log.Printf("failed to encode %s event: %v", e.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		flusher.Flush()
+	}
+}
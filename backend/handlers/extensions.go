@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Renter asks to extend a rental to a later end date --------------
+func RequestExtension(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ExtensionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ext, err := models.RequestExtension(rentalID, userID, req.EndDate)
+	if err != nil {
+		if writeOverlapError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, models.ErrInvalidDates):
+			http.Error(w, "New end date must be after the current end date and in the future", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Rental not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrForbidden):
+			http.Error(w, "Only the renter can extend a rental", http.StatusForbidden)
+		case errors.Is(err, models.ErrIllegalTransition):
+			http.Error(w, "Only approved or active rentals that aren't overdue can be extended", http.StatusConflict)
+		case errors.Is(err, models.ErrExtensionPending):
+			http.Error(w, "Rental already has an extension waiting on the owner", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to request extension", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ext)
+}
+
+// -------------- Get a rental's extensions (parties and moderators) --------------
+func GetRentalExtensions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeRentalParty(w, r, rentalID) {
+		return
+	}
+
+	extensions, err := models.GetRentalExtensions(rentalID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve extensions", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(extensions)
+}
+
+// -------------- Approve, reject or withdraw a pending extension --------------
+func DecideExtension(to string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		vars := mux.Vars(r)
+		rentalID, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+			return
+		}
+		extensionID, err := strconv.ParseInt(vars["extensionId"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid extension ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ext, rental, err := models.DecideExtension(rentalID, extensionID, userID, to)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrNotFound):
+				http.Error(w, "Extension not found", http.StatusNotFound)
+			case errors.Is(err, models.ErrExtensionClosed):
+				http.Error(w, "Extension was already decided", http.StatusConflict)
+			case errors.Is(err, models.ErrIllegalTransition):
+				http.Error(w, "Rental can no longer be extended", http.StatusConflict)
+			default:
+				writeRentalError(w, err)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"extension": ext,
+			"rental":    rental,
+		})
+	}
+}
@@ -2,14 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
+	"github.com/LuaanNguyen/backend/auth"
 	"github.com/LuaanNguyen/backend/middleware"
 	"github.com/LuaanNguyen/backend/models"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
 )
 
@@ -57,7 +57,59 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// send user with matching id
+	// Contact details are only for the user themselves and staff
+	callerID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if callerID != user.ID && !middleware.HasRole(r, models.RoleModerator, models.RoleAdmin) {
+		user = user.Public()
+	}
+
+	reputation, err := models.GetUserReputation(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+
+	// send user with matching id and their reputation
+	json.NewEncoder(w).Encode(models.UserProfile{User: user, Reputation: reputation})
+}
+
+// -------------- Change a user's role (admin only) --------------
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !models.ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Don't let the last admin lock everyone out by demoting themselves
+	userID, _ := middleware.GetUserIDFromContext(r)
+	if userID == id && req.Role != models.RoleAdmin {
+		http.Error(w, "Admins cannot demote themselves", http.StatusBadRequest)
+		return
+	}
+
+	user, err := models.UpdateUserRole(id, req.Role)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
 	json.NewEncoder(w).Encode(user)
 }
 
@@ -85,58 +137,163 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return 
 	}
 
-	// Get user from database (use models function)
-	user, err := models.GetUserByEmail(req.Email)
+	// Check the credentials, legacy plaintext passwords are upgraded to bcrypt here
+	user, err := auth.Authenticate(req.Email, req.Password)
 	if err != nil {
-		http.Error(w, "Invalid Email", http.StatusUnauthorized)
-		return 
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			http.Error(w, "Invalid Email or Password", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
 	}
 
-	// Verify password with bcypt (To be implemented)
-	// if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-    //     http.Error(w, "Invalid Email or Password", http.StatusUnauthorized)
-    //     return
-    // }
+	writeSession(w, user, http.StatusOK)
+}
+
+// -------------- register --------------
+func Register(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	if user.Password != req.Password {
-		http.Error(w, "Invalid Password", http.StatusUnauthorized)
-    	return
+	// Parse request body
+	var req models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	//Generate a JWT token 
-    expirationTime := time.Now().Add(24 * time.Hour)
-    claims := &models.Claims{
-        UserID: user.ID,
-        StandardClaims: jwt.StandardClaims{
-            ExpiresAt: expirationTime.Unix(),
-        },
-    }
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    jwtKey := []byte(os.Getenv("JWT_SECRET"))
-    tokenString, err := token.SignedString(jwtKey)
-    if err != nil {
-        http.Error(w, "Error creating token", http.StatusInternalServerError)
-        return
-    }
+	// Hash the password before it ever touches the database
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
 
-    // Send response
-    response := models.LoginResponse{
-        Token:     tokenString,
-        UserID:    user.ID,
-        FirstName: user.FirstName,
-        LastName:  user.LastName,
-    }
+	user := models.User{
+		Email:       req.Email,
+		PhoneNumber: req.PhoneNumber,
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		NickName:    req.NickName,
+		Password:    hashedPassword,
+	}
+
+	if err := models.CreateUser(&user); err != nil {
+		if errors.Is(err, models.ErrEmailTaken) {
+			http.Error(w, "Email already registered", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	// Sign the new user in straight away
+	writeSession(w, user, http.StatusCreated)
+}
+
+// -------------- exchange a refresh token for a new token pair --------------
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, refreshToken, err := auth.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := models.GetUser(userID)
+	if err != nil {
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, user, refreshToken, http.StatusOK)
+}
+
+// -------------- logout --------------
+func Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	claims, err := middleware.GetClaimsFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The refresh token is optional, without it only the access token is revoked
+	var req models.RefreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := auth.Revoke(claims, req.RefreshToken); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
 
-    json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Successfully logged out",
+	})
+}
+
+// writeSession starts a new session for the user and sends its tokens as a LoginResponse
+func writeSession(w http.ResponseWriter, user models.User, status int) {
+	refreshToken, err := auth.IssueRefreshToken(user.ID)
+	if err != nil {
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, user, refreshToken, status)
+}
+
+// writeTokens signs a fresh access token and sends it along with the refresh token
+func writeTokens(w http.ResponseWriter, user models.User, refreshToken string, status int) {
+	accessToken, err := auth.IssueToken(user.ID, user.Role)
+	if err != nil {
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(auth.AccessTokenTTL.Seconds()),
+		UserID:       user.ID,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+	})
 }
 
 // -------------- Get avaialble items for rent --------------
 func GetAvailableItems(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	
-    items, err := models.GetAvailableItemsWithOwners()
+    opts, ok := parseListOptions(w, r)
+    if !ok {
+        return
+    }
+
+    items, err := models.GetAvailableItemsWithOwners(opts)
     if err != nil {
         http.Error(w, "Failed to fetch items", http.StatusInternalServerError)
         return
@@ -157,10 +314,24 @@ func CreateRentalRequest(w http.ResponseWriter, r *http.Request) {
     
     // Get user ID from JWT token
     userID, _ := middleware.GetUserIDFromContext(r)
-    req.RenterID = int64(userID)
+    req.RenterID = userID
     
     if err := models.CreateRentalRequest(&req); err != nil {
-        http.Error(w, "Failed to create rental request", http.StatusInternalServerError)
+        if writeOverlapError(w, err) {
+            return
+        }
+        switch {
+        case errors.Is(err, models.ErrInvalidDates):
+            http.Error(w, "End date must be after start date, and start date can't be in the past", http.StatusBadRequest)
+        case errors.Is(err, models.ErrNotFound):
+            http.Error(w, "Item not found", http.StatusNotFound)
+        case errors.Is(err, models.ErrForbidden):
+            http.Error(w, "You cannot rent your own item", http.StatusForbidden)
+        case errors.Is(err, models.ErrItemUnavailable):
+            http.Error(w, "Item is not available", http.StatusConflict)
+        default:
+            http.Error(w, "Failed to create rental request", http.StatusInternalServerError)
+        }
         return
     }
     
@@ -179,7 +350,7 @@ func GetMyRentals(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Get user's rental requests
-	rentals, err := models.GetMyRentals(int64(userID))
+	rentals, err := models.GetMyRentals(userID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve rental requests: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -204,6 +375,84 @@ func GetAllCategories(w http. ResponseWriter, r *http.Request) {
 }
 
 
+// -------------- Create a category (admin only) --------------
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil || category.Name == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.CreateCategory(&category); err != nil {
+		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// -------------- Update a category (admin only) --------------
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil || category.Name == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	category.ID = id
+
+	updated, err := models.UpdateCategory(&category)
+	if err != nil {
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+	if !updated {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(category)
+}
+
+// -------------- Delete a category (admin only) --------------
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	isDeleted, err := models.DeleteCategory(id)
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryInUse) {
+			http.Error(w, "Category still has items", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+	if !isDeleted {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Category successfully deleted",
+	})
+}
+
 // -------------- Create new rental items --------------
 func CreateItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -217,13 +466,20 @@ func CreateItem(w http.ResponseWriter, r *http.Request) {
 
 	// get the user ID from JWT token and set as owner
 	userID, _ := middleware.GetUserIDFromContext(r)
-	item.OwnerID = int64(userID)
+	item.OwnerID = userID
 
 
 	// Set defaults 
 	if item.DateListed.IsZero() {
 		item.DateListed = time.Now()
 	}
+	if item.CancellationPolicy == "" {
+		item.CancellationPolicy = models.PolicyFlexible
+	}
+	if !models.ValidCancellationPolicy(item.CancellationPolicy) {
+		http.Error(w, "Invalid cancellation policy, expected flexible, moderate or strict", http.StatusBadRequest)
+		return
+	}
 
 	// Create the item 
 	if err := models.CreateItem(&item); err != nil {
@@ -250,7 +506,11 @@ func GetItem(w http.ResponseWriter, r *http.Request) {
 	
 	item, err := models.GetItem(int64(id))
 	if err != nil {
-		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve item", http.StatusInternalServerError)
 		return
 	}
 
@@ -270,24 +530,41 @@ func UpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only the owner may edit a listing
+	if !authorizeItemOwner(w, r, id) {
+		return
+	}
+
 	var itemData models.ItemData;
 	
 	if err := json.NewDecoder(r.Body).Decode(&itemData); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if itemData.CancellationPolicy != nil && !models.ValidCancellationPolicy(*itemData.CancellationPolicy) {
+		http.Error(w, "Invalid cancellation policy, expected flexible, moderate or strict", http.StatusBadRequest)
+		return
+	}
 
+	userID, _ := middleware.GetUserIDFromContext(r)
 	item, err := models.UpdateItem(
 		id,
+		userID,
 		itemData.Name,
 		itemData.Description,
-		itemData.Image,
 		itemData.Price,
 		itemData.Quantity,
 		itemData.Available,
+		itemData.Deposit,
+		itemData.CancellationPolicy,
+		itemData.LateFee,
 	)
 	
 	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Failed to update item", http.StatusInternalServerError)
 		return
 	}
@@ -295,7 +572,7 @@ func UpdateItem(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(item)
 }
 
-// -------------- Get item by ID --------------
+// -------------- Delete item by ID --------------
 func DeleteItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
@@ -305,7 +582,13 @@ func DeleteItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	isDeleted, err := models.DeleteItem(int64(id))
+	// Owners remove their own listings, moderators and admins can take down any
+	if !authorizeItemOwner(w, r, int64(id), models.RoleModerator, models.RoleAdmin) {
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r)
+	isDeleted, keys, err := models.DeleteItem(int64(id), userID, middleware.HasRole(r, models.RoleModerator, models.RoleAdmin))
 	if err != nil {
 		http.Error(w, "Failed to delete item", http.StatusInternalServerError)
 		return 
@@ -315,6 +598,7 @@ func DeleteItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
+	deleteStoredImage(keys...)
 
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Item successfully deleted",
@@ -355,6 +639,12 @@ func SearchItems(w http.ResponseWriter, r *http.Request) {
         params.Available = &isAvailable
     }
 
+    opts, ok := parseListOptions(w, r)
+    if !ok {
+        return
+    }
+    params.ListOptions = opts
+
     // Perform search
     items, err := models.SearchItems(params)
     if err != nil {
@@ -365,3 +655,25 @@ func SearchItems(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(items)
 }
 
+
+// -------------- Parse the shared min_rating and sort listing filters --------------
+func parseListOptions(w http.ResponseWriter, r *http.Request) (models.ListOptions, bool) {
+    var opts models.ListOptions
+
+    if minRating := r.URL.Query().Get("min_rating"); minRating != "" {
+        rating, err := strconv.ParseFloat(minRating, 64)
+        if err != nil || rating < 0 || rating > 5 {
+            http.Error(w, "min_rating must be a number between 0 and 5", http.StatusBadRequest)
+            return opts, false
+        }
+        opts.MinRating = &rating
+    }
+
+    opts.Sort = r.URL.Query().Get("sort")
+    if !models.ValidSort(opts.Sort) {
+        http.Error(w, "Invalid sort, expected newest, rating, price_asc or price_desc", http.StatusBadRequest)
+        return opts, false
+    }
+
+    return opts, true
+}
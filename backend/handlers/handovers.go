@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LuaanNguyen/backend/images"
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/LuaanNguyen/backend/storage"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Confirm a pickup (checkout) or return (checkin) --------------
+// Takes JSON {"notes": ...}, or multipart with a "notes" field and optional "images".
+func ConfirmHandover(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var notes string
+		var uploads []upload
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			r.Body = http.MaxBytesReader(w, r.Body, models.MaxHandoverPhotos*images.MaxUploadBytes+maxMultipartOverhead)
+			if err := r.ParseMultipartForm(images.MaxUploadBytes); err != nil {
+				http.Error(w, "Invalid multipart body or upload too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+
+			notes = r.FormValue("notes")
+			var ok bool
+			if uploads, ok = validateUploads(w, r.MultipartForm.File["images"]); !ok {
+				return
+			}
+		} else if r.ContentLength != 0 {
+			var req models.HandoverRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			notes = req.Notes
+		}
+
+		// Store the bytes first, the rows are written with the confirmation
+		photos := []models.HandoverPhoto{}
+		var keys []string
+		for _, u := range uploads {
+			key, err := storage.NewKey(fmt.Sprintf("handovers/%d", rentalID))
+			if err == nil {
+				err = storage.Default.Put(key, u.data, u.contentType)
+			}
+			if err != nil {
+				deleteStoredImage(keys...)
+				http.Error(w, "Failed to store photo", http.StatusInternalServerError)
+				return
+			}
+			keys = append(keys, key)
+			photos = append(photos, models.HandoverPhoto{ContentType: u.contentType, Size: len(u.data), StorageKey: key})
+		}
+
+		report, rental, err := models.ConfirmHandover(rentalID, userID, kind, notes, photos)
+		if err != nil {
+			// No photo row was committed, their bytes would be orphans
+			deleteStoredImage(keys...)
+			switch {
+			case errors.Is(err, models.ErrIllegalTransition):
+				http.Error(w, fmt.Sprintf("Rental is not ready for %s", kind), http.StatusConflict)
+			case errors.Is(err, models.ErrAlreadyConfirmed):
+				http.Error(w, fmt.Sprintf("You already confirmed the %s", kind), http.StatusConflict)
+			case errors.Is(err, models.ErrTooManyPhotos):
+				http.Error(w, fmt.Sprintf("A handover can have at most %d photos", models.MaxHandoverPhotos), http.StatusConflict)
+			default:
+				writeRentalError(w, err)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"report": report,
+			"rental": rental,
+		})
+	}
+}
+
+// authorizeRentalParty lets the parties of a rental and moderators through
+func authorizeRentalParty(w http.ResponseWriter, r *http.Request, rentalID int64) bool {
+	rental, err := models.GetRental(rentalID)
+	if err != nil {
+		writeRentalError(w, err)
+		return false
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if rental.PartyOf(userID) == "" && !middleware.HasRole(r, models.RoleModerator, models.RoleAdmin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// -------------- Get a rental's checkout and checkin reports (parties and moderators) --------------
+func GetHandoverReports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeRentalParty(w, r, rentalID) {
+		return
+	}
+
+	reports, err := models.GetHandoverReports(rentalID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve handover reports", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reports)
+}
+
+// -------------- Stream a handover photo (parties and moderators) --------------
+func ServeHandoverPhoto(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rentalID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+	photoID, err := strconv.ParseInt(vars["photoId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid photo ID", http.StatusBadRequest)
+		return
+	}
+	if !authorizeRentalParty(w, r, rentalID) {
+		return
+	}
+
+	photo, err := models.GetHandoverPhoto(rentalID, photoID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve photo", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := storage.Default.Get(photo.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Photo not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve photo", http.StatusInternalServerError)
+		return
+	}
+
+	// Handover photos never change, but they are private to the rental
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("Content-Type", photo.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", photo.CreatedAt.Truncate(time.Second), bytes.NewReader(data))
+}
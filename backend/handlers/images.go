@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LuaanNguyen/backend/images"
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/LuaanNguyen/backend/storage"
+	"github.com/gorilla/mux"
+)
+
+// Multipart overhead allowance on top of the photos themselves
+const maxMultipartOverhead = 1 << 20
+
+// upload is a validated photo waiting to be stored
+type upload struct {
+	data        []byte
+	contentType string
+	thumbnail   []byte
+}
+
+// -------------- Upload one or more photos to an item (owner only) --------------
+func UploadItemImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	itemID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItemOwner(w, r, itemID) {
+		return
+	}
+
+	uploads, ok := readUploads(w, r, models.MaxImagesPerItem)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserIDFromContext(r)
+
+	created := []models.ItemImage{}
+	for _, u := range uploads {
+		img, err := storeItemImage(itemID, userID, u)
+		if err != nil {
+			// All or nothing, take back the photos of this upload that did make it
+			for i := len(created) - 1; i >= 0; i-- {
+				if _, err := models.DeleteItemImage(itemID, created[i].Position, userID); err != nil {
+					log.Printf("failed to roll back image %d of item %d: %v", created[i].Position, itemID, err)
+					continue
+				}
+				deleteStoredImage(created[i].StorageKey, created[i].ThumbKey)
+			}
+			if errors.Is(err, models.ErrTooManyImages) {
+				http.Error(w, fmt.Sprintf("An item can have at most %d images", models.MaxImagesPerItem), http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to store image", http.StatusInternalServerError)
+			return
+		}
+		created = append(created, img)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// readUploads parses and validates the photos in the multipart "images" field,
+// writing the error response itself when something is wrong
+func readUploads(w http.ResponseWriter, r *http.Request, maxFiles int) ([]upload, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxFiles)*images.MaxUploadBytes+maxMultipartOverhead)
+	if err := r.ParseMultipartForm(images.MaxUploadBytes); err != nil {
+		http.Error(w, "Invalid multipart body or upload too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		http.Error(w, "No images uploaded, use the \"images\" form field", http.StatusBadRequest)
+		return nil, false
+	}
+	return validateUploads(w, files)
+}
+
+// validateUploads reads and checks every photo before anything is stored,
+// so a bad file doesn't leave half an upload behind
+func validateUploads(w http.ResponseWriter, files []*multipart.FileHeader) ([]upload, bool) {
+	var uploads []upload
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return nil, false
+		}
+		data, err := io.ReadAll(io.LimitReader(f, images.MaxUploadBytes+1))
+		f.Close()
+		if err != nil {
+			http.Error(w, "Failed to read upload", http.StatusBadRequest)
+			return nil, false
+		}
+
+		contentType, err := images.Sniff(data)
+		if err == nil {
+			var thumb []byte
+			if thumb, err = images.Thumbnail(data); err == nil {
+				uploads = append(uploads, upload{data: data, contentType: contentType, thumbnail: thumb})
+				continue
+			}
+		}
+		if errors.Is(err, images.ErrTooLarge) {
+			http.Error(w, fmt.Sprintf("%s is too large, the limit is %d MB", fh.Filename, images.MaxUploadBytes>>20), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, fmt.Sprintf("%s is not a JPEG, PNG or GIF image", fh.Filename), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	return uploads, true
+}
+
+// storeItemImage writes the bytes to storage and then records the row,
+// cleaning the bytes up again if the row can't be written
+func storeItemImage(itemID, ownerID int64, u upload) (models.ItemImage, error) {
+	prefix := fmt.Sprintf("items/%d", itemID)
+	key, err := storage.NewKey(prefix)
+	if err != nil {
+		return models.ItemImage{}, err
+	}
+	thumbKey := key + "-thumb"
+
+	if err := storage.Default.Put(key, u.data, u.contentType); err != nil {
+		return models.ItemImage{}, err
+	}
+	if err := storage.Default.Put(thumbKey, u.thumbnail, images.ThumbnailContentType); err != nil {
+		deleteStoredImage(key, "")
+		return models.ItemImage{}, err
+	}
+
+	sum := sha256.Sum256(u.data)
+	img := models.ItemImage{
+		ItemID:      itemID,
+		ContentType: u.contentType,
+		Size:        len(u.data),
+		ETag:        hex.EncodeToString(sum[:]),
+		StorageKey:  key,
+		ThumbKey:    thumbKey,
+	}
+	if err := models.AddItemImage(&img, ownerID); err != nil {
+		deleteStoredImage(key, thumbKey)
+		return models.ItemImage{}, err
+	}
+	return img, nil
+}
+
+// deleteStoredImage removes stored bytes, only logging failures since the row is already gone
+func deleteStoredImage(keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(key); err != nil {
+			log.Printf("failed to delete stored image %s: %v", key, err)
+		}
+	}
+}
+
+// -------------- List an item's photos --------------
+func GetItemImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	itemID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	imgs, err := models.GetItemImages(itemID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve images", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(imgs)
+}
+
+// -------------- Stream the n-th photo of an item, ?size=thumb for the thumbnail --------------
+func ServeItemImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	itemID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	position, err := strconv.Atoi(vars["n"])
+	if err != nil || position < 1 {
+		http.Error(w, "Invalid image number", http.StatusBadRequest)
+		return
+	}
+
+	img, err := models.GetItemImage(itemID, position)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve image", http.StatusInternalServerError)
+		return
+	}
+
+	key, contentType, etag := img.StorageKey, img.ContentType, img.ETag
+	if r.URL.Query().Get("size") == "thumb" {
+		key, contentType, etag = img.ThumbKey, images.ThumbnailContentType, img.ETag+"-thumb"
+	}
+
+	// The URL is positional, so a reorder changes what it points at: cache briefly, then revalidate by ETag
+	etag = `"` + etag + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := storage.Default.Get(key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve image", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", img.CreatedAt.Truncate(time.Second), bytes.NewReader(data))
+}
+
+// -------------- Delete the n-th photo of an item (owner only) --------------
+func DeleteItemImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	itemID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	position, err := strconv.Atoi(vars["n"])
+	if err != nil || position < 1 {
+		http.Error(w, "Invalid image number", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItemOwner(w, r, itemID) {
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r)
+	img, err := models.DeleteItemImage(itemID, position, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete image", http.StatusInternalServerError)
+		return
+	}
+	deleteStoredImage(img.StorageKey, img.ThumbKey)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Image successfully deleted",
+	})
+}
+
+// -------------- Reorder an item's photos (owner only) --------------
+func ReorderItemImages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	itemID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeItemOwner(w, r, itemID) {
+		return
+	}
+
+	var req models.ImageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(r)
+	imgs, err := models.ReorderItemImages(itemID, req.Order, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidOrder):
+			http.Error(w, "order must list every current image position exactly once", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Item not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to reorder images", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(imgs)
+}
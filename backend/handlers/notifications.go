@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Get the current user's notifications: ?unread=true&before=<id>&limit=50 --------------
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	unreadOnly := false
+	if value := query.Get("unread"); value != "" {
+		if unreadOnly, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid unread", http.StatusBadRequest)
+			return
+		}
+	}
+	var before int64
+	if value := query.Get("before"); value != "" {
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before < 1 {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := models.DefaultNotificationPage
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > models.MaxNotificationPage {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", models.MaxNotificationPage), http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := models.GetNotifications(userID, unreadOnly, before, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve notifications", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// -------------- Count the current user's unread notifications --------------
+func GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := models.GetUnreadNotificationCount(userID)
+	if err != nil {
+		http.Error(w, "Failed to count unread notifications", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"unread": count})
+}
+
+// -------------- Mark one notification as read --------------
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	notification, err := models.MarkNotificationRead(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to mark notification read", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(notification)
+}
+
+// -------------- Mark all of the current user's notifications as read --------------
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	read, err := models.MarkAllNotificationsRead(userID)
+	if err != nil {
+		http.Error(w, "Failed to mark notifications read", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{"read": read})
+}
+
+// -------------- Get the current user's notification preferences --------------
+func GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := models.GetNotificationSettings(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+// -------------- Update the current user's notification preferences --------------
+func UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.NotificationSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := models.UpdateNotificationSettings(userID, req)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidSettings) {
+			http.Error(w, "Invalid time zone, quiet hours, kind or delivery", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to update notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+)
+
+// -------------- Ownership policy shared by item, rental and review mutations --------------
+
+// authorizeOwner lets the request through if the current user is ownerID or
+// has one of staffRoles. Otherwise it writes 401/403 and returns false.
+func authorizeOwner(w http.ResponseWriter, r *http.Request, ownerID int64, staffRoles ...string) bool {
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if userID == ownerID || (len(staffRoles) > 0 && middleware.HasRole(r, staffRoles...)) {
+		return true
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// authorizeItemOwner looks up the item's owner first so a missing item is a 404, not a 403
+func authorizeItemOwner(w http.ResponseWriter, r *http.Request, itemID int64, staffRoles ...string) bool {
+	ownerID, err := models.GetItemOwnerID(itemID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Failed to retrieve item", http.StatusInternalServerError)
+		return false
+	}
+	return authorizeOwner(w, r, ownerID, staffRoles...)
+}
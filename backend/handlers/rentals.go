@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Get rental requests for the current user's items --------------
+func GetIncomingRentals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Optional ?status= filter, e.g. only pending requests
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.ValidRentalStatus(status) {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	rentals, err := models.GetIncomingRentals(userID, status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve incoming rentals", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rentals)
+}
+
+// -------------- Get overdue rentals for the current user's items --------------
+func GetOverdueRentals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rentals, err := models.GetOverdueRentals(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve overdue rentals", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rentals)
+}
+
+// -------------- Move a rental to a new status (approve, reject, cancel, complete) --------------
+func ChangeRentalStatus(to string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := middleware.GetUserIDFromContext(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rental, err := models.TransitionRental(id, userID, to)
+		if err != nil {
+			writeRentalError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(rental)
+	}
+}
+
+// -------------- Quote the price of renting an item for the given dates --------------
+func GetQuote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	start, err := parseDate(r.URL.Query().Get("start"))
+	if err != nil {
+		http.Error(w, "Invalid start date", http.StatusBadRequest)
+		return
+	}
+	end, err := parseDate(r.URL.Query().Get("end"))
+	if err != nil {
+		http.Error(w, "Invalid end date", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := models.QuoteRental(id, start, end)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidDates):
+			http.Error(w, "End date must be after start date", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Item not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to quote rental", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(quote)
+}
+
+// parseDate accepts a full RFC 3339 timestamp or a plain 2006-01-02 date (midnight UTC)
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// writeOverlapError answers 409 with the conflicting window so the client can suggest other dates.
+// It returns false if err isn't an overbooking.
+func writeOverlapError(w http.ResponseWriter, err error) bool {
+	var overlap *models.OverlapError
+	if !errors.As(err, &overlap) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+		*models.OverlapError
+	}{overlap.Error(), overlap})
+	return true
+}
+
+// -------------- Preview the refund for cancelling an approved rental --------------
+func GetCancellationRefund(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	refund, err := models.PreviewRefund(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrIllegalTransition) {
+			http.Error(w, "Only approved rentals have a cancellation refund", http.StatusConflict)
+			return
+		}
+		writeRentalError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(refund)
+}
+
+// writeRentalError maps rental model errors to status codes
+func writeRentalError(w http.ResponseWriter, err error) {
+	if writeOverlapError(w, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		http.Error(w, "Rental not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, models.ErrIllegalTransition):
+		http.Error(w, "Rental cannot move to that status", http.StatusConflict)
+	case errors.Is(err, models.ErrHandoverRequired):
+		http.Error(w, "Active rentals move through checkout and checkin", http.StatusConflict)
+	case errors.Is(err, models.ErrPaymentDeclined):
+		http.Error(w, "Payment was declined", http.StatusPaymentRequired)
+	case errors.Is(err, models.ErrClaimPending):
+		http.Error(w, "Rental has a damage claim waiting on a decision", http.StatusConflict)
+	case errors.Is(err, models.ErrDisputePending):
+		http.Error(w, "Rental has a dispute waiting on a ruling", http.StatusConflict)
+	default:
+		http.Error(w, "Failed to update rental", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
+	"github.com/gorilla/mux"
+)
+
+// -------------- Review the other party of a completed rental --------------
+func CreateRentalReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rentalID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid rental ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	review, err := models.CreateRentalReview(rentalID, userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidReview):
+			http.Error(w, "Ratings must be between 1 and 5; item_star is for renters, condition_star and on_time for owners", http.StatusBadRequest)
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Rental not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrForbidden):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case errors.Is(err, models.ErrRentalNotCompleted):
+			http.Error(w, "Only completed rentals can be reviewed", http.StatusConflict)
+		case errors.Is(err, models.ErrAlreadyReviewed):
+			http.Error(w, "You already reviewed this rental", http.StatusConflict)
+		case errors.Is(err, models.ErrReviewWindowClosed):
+			http.Error(w, "The review window for this rental has closed", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to create review", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// -------------- Get published reviews of an item --------------
+func GetItemReviews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	itemID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := models.GetItemReviews(itemID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve reviews", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// -------------- Get published reviews a user received --------------
+func GetUserReviews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Optional ?direction=renter_to_owner|owner_to_renter
+	direction := r.URL.Query().Get("direction")
+	if direction != "" && direction != models.RenterToOwner && direction != models.OwnerToRenter {
+		http.Error(w, "Invalid direction", http.StatusBadRequest)
+		return
+	}
+
+	reviews, err := models.GetUserReviews(userID, direction)
+	if err != nil {
+		http.Error(w, "Failed to retrieve reviews", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reviews)
+}
@@ -0,0 +1,135 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+
+	// Register the decoders for the formats we accept
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// MaxUploadBytes is the largest single photo we accept
+	MaxUploadBytes = 5 << 20
+	// MaxPixels guards against decompression bombs. It is checked from the header before
+	// decoding; a 4000x3000 photo is 12M pixels, up to 48 MB once decoded.
+	MaxPixels = 12_000_000
+	// ThumbnailSize is the longest side of a generated thumbnail
+	ThumbnailSize = 320
+	// ThumbnailContentType is what every thumbnail is encoded as
+	ThumbnailContentType = "image/jpeg"
+)
+
+// ErrUnsupportedType is returned for anything that isn't a JPEG, PNG or GIF
+var ErrUnsupportedType = errors.New("unsupported image type")
+
+// ErrTooLarge is returned for photos over MaxUploadBytes or MaxPixels
+var ErrTooLarge = errors.New("image too large")
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Sniff detects the content type from the bytes themselves, never trusting the
+// client's Content-Type, and checks it is one we can decode.
+func Sniff(data []byte) (string, error) {
+	if len(data) > MaxUploadBytes {
+		return "", ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Thumbnail decodes an uploaded photo and returns a JPEG no larger than
+// ThumbnailSize on its longest side. Transparent areas become white.
+func Thumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxPixels || cfg.Height > MaxPixels || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+
+	dst := resize(src, ThumbnailSize)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("error encoding thumbnail: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// boxSamples caps how many source pixels per axis are averaged into one thumbnail pixel
+const boxSamples = 4
+
+// resize scales src down so its longest side is at most limit, averaging up to
+// boxSamples x boxSamples source pixels from each destination pixel's box. It reads
+// src directly rather than copying it, so a large photo isn't held in memory twice.
+// Transparent pixels are blended onto white so they don't turn black in the JPEG.
+func resize(src image.Image, limit int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w >= h && w > limit {
+		dw, dh = limit, h*limit/w
+	} else if h > w && h > limit {
+		dw, dh = w*limit/h, limit
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, (y+1)*h/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		ystep := (y1 - y0 + boxSamples - 1) / boxSamples
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, (x+1)*w/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			xstep := (x1 - x0 + boxSamples - 1) / boxSamples
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy += ystep {
+				for sx := x0; sx < x1; sx += xstep {
+					// Premultiplied 16-bit channels, so adding the white left uncovered flattens it
+					cr, cg, cb, ca := src.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					white := 0xffff - ca
+					r += (cr + white) >> 8
+					g += (cg + white) >> 8
+					bl += (cb + white) >> 8
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
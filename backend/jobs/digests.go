@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/LuaanNguyen/backend/models"
+)
+
+// DefaultDigestInterval is how often due digests are looked for without DIGEST_INTERVAL
+const DefaultDigestInterval = 15 * time.Minute
+
+// DigestInterval reads DIGEST_INTERVAL, a Go duration such as "1m"
+func DigestInterval() (time.Duration, error) {
+	value := os.Getenv("DIGEST_INTERVAL")
+	if value == "" {
+		return DefaultDigestInterval, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// RunDigests emails the daily digests that are due once at start and then every interval,
+// until the process exits. It needs the email channel. Run it in its own goroutine.
+func RunDigests(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sendDigests()
+		<-ticker.C
+	}
+}
+
+func sendDigests() {
+	sent, err := models.SendDigests(time.Now())
+	if err != nil {
+		log.Printf("Digest emails failed: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Sent %d digest emails", sent)
+	}
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/LuaanNguyen/backend/models"
+)
+
+// DefaultLateReturnInterval is how often late returns are checked without LATE_RETURN_INTERVAL
+const DefaultLateReturnInterval = time.Hour
+
+// LateReturnInterval reads LATE_RETURN_INTERVAL, a Go duration such as "15m"
+func LateReturnInterval() (time.Duration, error) {
+	value := os.Getenv("LATE_RETURN_INTERVAL")
+	if value == "" {
+		return DefaultLateReturnInterval, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// RunLateReturns flags overdue rentals and accrues late fees once at start and then every
+// interval, until the process exits. Run it in its own goroutine.
+func RunLateReturns(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		checkLateReturns()
+		<-ticker.C
+	}
+}
+
+func checkLateReturns() {
+	updated, err := models.ProcessLateReturns(time.Now())
+	if err != nil {
+		log.Printf("Late return check failed: %v", err)
+	}
+	if updated > 0 {
+		log.Printf("Late return check updated %d rentals", updated)
+	}
+}
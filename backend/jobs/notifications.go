@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/LuaanNguyen/backend/models"
+)
+
+// DefaultNotifyInterval is how often the outbox is checked without NOTIFY_INTERVAL
+const DefaultNotifyInterval = 10 * time.Second
+
+// NotifyInterval reads NOTIFY_INTERVAL, a Go duration such as "30s"
+func NotifyInterval() (time.Duration, error) {
+	value := os.Getenv("NOTIFY_INTERVAL")
+	if value == "" {
+		return DefaultNotifyInterval, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// RunNotifications delivers notifications from the outbox once at start and then every
+// interval, until the process exits. Run it in its own goroutine.
+func RunNotifications(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		dispatchNotifications()
+		<-ticker.C
+	}
+}
+
+func dispatchNotifications() {
+	sent, err := models.DispatchNotifications(time.Now())
+	if err != nil {
+		log.Printf("Notification dispatch failed: %v", err)
+	}
+	if sent > 0 {
+		log.Printf("Notification dispatch sent %d notifications", sent)
+	}
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/LuaanNguyen/backend/models"
+)
+
+// DefaultPaymentInterval is how often queued payments are retried without PAYMENT_INTERVAL
+const DefaultPaymentInterval = time.Minute
+
+// PaymentInterval reads PAYMENT_INTERVAL, a Go duration such as "30s"
+func PaymentInterval() (time.Duration, error) {
+	value := os.Getenv("PAYMENT_INTERVAL")
+	if value == "" {
+		return DefaultPaymentInterval, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// RunPayments sends the captures, refunds and payouts still queued once at start and then every
+// interval, until the process exits. Run it in its own goroutine.
+func RunPayments(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		processPayments()
+		<-ticker.C
+	}
+}
+
+func processPayments() {
+	done, err := models.ProcessPayments(time.Now())
+	if err != nil {
+		log.Printf("Payment processing failed: %v", err)
+	}
+	if done > 0 {
+		log.Printf("Sent %d queued payments", done)
+	}
+}
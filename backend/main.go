@@ -7,7 +7,12 @@ import (
 	"os"
 
 	"github.com/LuaanNguyen/backend/db"
+	"github.com/LuaanNguyen/backend/events"
+	"github.com/LuaanNguyen/backend/jobs"
+	"github.com/LuaanNguyen/backend/notifications"
+	"github.com/LuaanNguyen/backend/payments"
 	"github.com/LuaanNguyen/backend/router"
+	"github.com/LuaanNguyen/backend/storage"
 )
 
 func main() {
@@ -18,6 +23,58 @@ func main() {
 	}
 	defer db.DB.Close()
 
+	// Pick where item photos are stored
+	if err := storage.InitStore(); err != nil {
+		log.Fatalf("Failed to initialize image storage: %v", err)
+	}
+
+	// Pick who moves the money for rentals
+	if err := payments.InitProvider(); err != nil {
+		log.Fatalf("Failed to initialize payment provider: %v", err)
+	}
+
+	// Pick how live updates reach connected users
+	if err := events.InitBroker(); err != nil {
+		log.Fatalf("Failed to initialize event broker: %v", err)
+	}
+
+	// Pick how notifications are delivered
+	if err := notifications.InitChannels(); err != nil {
+		log.Fatalf("Failed to initialize notification channels: %v", err)
+	}
+
+	// Flag late returns and accrue late fees in the background
+	interval, err := jobs.LateReturnInterval()
+	if err != nil || interval <= 0 {
+		log.Fatalf("Invalid LATE_RETURN_INTERVAL %q", os.Getenv("LATE_RETURN_INTERVAL"))
+	}
+	go jobs.RunLateReturns(interval)
+
+	// Send captures, refunds and payouts that didn't go through right away
+	paymentInterval, err := jobs.PaymentInterval()
+	if err != nil || paymentInterval <= 0 {
+		log.Fatalf("Invalid PAYMENT_INTERVAL %q", os.Getenv("PAYMENT_INTERVAL"))
+	}
+	go jobs.RunPayments(paymentInterval)
+
+	// Deliver queued notifications in the background
+	notifyInterval, err := jobs.NotifyInterval()
+	if err != nil || notifyInterval <= 0 {
+		log.Fatalf("Invalid NOTIFY_INTERVAL %q", os.Getenv("NOTIFY_INTERVAL"))
+	}
+	go jobs.RunNotifications(notifyInterval)
+
+	// Email daily digests, which go out through the email channel
+	digestInterval, err := jobs.DigestInterval()
+	if err != nil || digestInterval <= 0 {
+		log.Fatalf("Invalid DIGEST_INTERVAL %q", os.Getenv("DIGEST_INTERVAL"))
+	}
+	if notifications.Lookup("email") != nil {
+		go jobs.RunDigests(digestInterval)
+	} else {
+		log.Println("Digest emails are off, add email to NOTIFY_CHANNELS to send them")
+	}
+
 	// Create router with database connection
 	r := router.Router(db.DB)
 
@@ -2,100 +2,17 @@ package middleware
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
 	"errors"
 	"net/http"
-	"os"
-	"time"
+	"strings"
 
-	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/LuaanNguyen/backend/auth"
 )
 
-// JWT secret key
-var jwtKey []byte
+// contextKey keeps our context values from colliding with other packages
+type contextKey string
 
-func init() {
-	jwtKey = []byte(os.Getenv("JWT_SECRET"))
-	if len(jwtKey) == 0 {
-		jwtKey = []byte("your-secret-key") // Fallback for dev
-	}
-}
-
-// Claims represents the JWT claims
-type Claims struct {
-	UserID int `json:"user_id"`
-	jwt.StandardClaims
-}
-
-// LoginRequest represents the login request body
-type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-// LoginResponse represents the login response
-type LoginResponse struct {
-	Token string `json:"token"`
-	UserID int  `json:"user_id"`
-}
-
-// Login handles user authentication
-func Login(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse request body
-		var req LoginRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// Query user from database
-		var userID int
-		var hashedPassword string
-		err := db.QueryRow("SELECT u_id, u_password FROM users WHERE u_email = $1", req.Email).Scan(&userID, &hashedPassword)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				http.Error(w, "Invalid email or password", http.StatusUnauthorized)
-				return
-			}
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			return
-		}
-
-		// Verify password
-		if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)); err != nil {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
-			return
-		}
-
-		// Create JWT token
-		expirationTime := time.Now().Add(24 * time.Hour)
-		claims := &Claims{
-			UserID: userID,
-			StandardClaims: jwt.StandardClaims{
-				ExpiresAt: expirationTime.Unix(),
-			},
-		}
-
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString(jwtKey)
-		if err != nil {
-			http.Error(w, "Error creating token", http.StatusInternalServerError)
-			return
-		}
-
-		// Send response
-		response := LoginResponse{
-			Token:  tokenString,
-			UserID: userID,
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	}
-}
+const claimsKey contextKey = "claims"
 
 // AuthMiddleware verifies JWT token
 func AuthMiddleware(next http.Handler) http.Handler {
@@ -109,35 +26,97 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 		// Check if token starts with "Bearer " prefix and remove it
 		const bearerPrefix = "Bearer "
-		if len(tokenString) > len(bearerPrefix) && tokenString[:len(bearerPrefix)] == bearerPrefix {
-			tokenString = tokenString[len(bearerPrefix):]
-		} else {
+		if !strings.HasPrefix(tokenString, bearerPrefix) || len(tokenString) == len(bearerPrefix) {
 			http.Error(w, "Invalid token format", http.StatusUnauthorized)
 			return
 		}
+		tokenString = tokenString[len(bearerPrefix):]
 
-		// Parse the token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		authenticate(w, r, tokenString, next)
+	})
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+// StreamAuthMiddleware is AuthMiddleware for event streams. Browsers' EventSource can't set
+// headers, so the same JWT may also come as the access_token query parameter.
+func StreamAuthMiddleware(next http.Handler) http.Handler {
+	header := AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if r.Header.Get("Authorization") != "" || token == "" {
+			header.ServeHTTP(w, r)
 			return
 		}
-
-		// Add the user ID to the request context
-		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		authenticate(w, r, token, next)
 	})
 }
 
-// GetUserIDFromContext retrieves user ID from request context
-func GetUserIDFromContext(r *http.Request) (int, error) {
-	userID, ok := r.Context().Value("user_id").(int)
+// authenticate verifies the token and calls next with its claims in the request context
+func authenticate(w http.ResponseWriter, r *http.Request, tokenString string, next http.Handler) {
+	// Parse the token
+	claims, err := auth.ParseToken(tokenString)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Reject tokens that were logged out before they expired
+	revoked, err := auth.IsRevoked(claims)
+	if err != nil {
+		http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	// Add the claims to the request context
+	ctx := context.WithValue(r.Context(), claimsKey, claims)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// GetClaimsFromContext retrieves the verified token claims from request context
+func GetClaimsFromContext(r *http.Request) (*auth.Claims, error) {
+	claims, ok := r.Context().Value(claimsKey).(*auth.Claims)
 	if !ok {
+		return nil, errors.New("claims not found in context")
+	}
+	return claims, nil
+}
+
+// GetUserIDFromContext retrieves user ID from request context
+func GetUserIDFromContext(r *http.Request) (int64, error) {
+	claims, err := GetClaimsFromContext(r)
+	if err != nil {
 		return 0, errors.New("user ID not found in context")
 	}
-	return userID, nil
-} 
\ No newline at end of file
+	return claims.UserID, nil
+}
+
+// RequireRole only lets requests through whose token carries one of the given roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := GetClaimsFromContext(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasRole(roles...) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasRole reports whether the authenticated user has one of the given roles
+func HasRole(r *http.Request, roles ...string) bool {
+	claims, err := GetClaimsFromContext(r)
+	if err != nil {
+		return false
+	}
+	return claims.HasRole(roles...)
+}
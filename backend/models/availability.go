@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+type Blackout struct {
+	ID        int64     `json:"id"`
+	ItemID    int64     `json:"item_id"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Reason    *string   `json:"reason,omitempty"` // nullable
+}
+
+// BookedRange is a window taken by a rental, renter details are left out on purpose
+type BookedRange struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+type Availability struct {
+	ItemID   int64         `json:"item_id"`
+	Quantity int           `json:"quantity"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Booked   []BookedRange `json:"booked"`
+	Pending  []BookedRange `json:"pending"`
+	Blocked  []Blackout    `json:"blocked"`
+}
+
+// -------------- Get booked, pending and blocked ranges of an item between from and to --------------
+func GetItemAvailability(itemID int64, from, to time.Time) (Availability, error) {
+	a := Availability{
+		ItemID:  itemID,
+		From:    from,
+		To:      to,
+		Booked:  []BookedRange{},
+		Pending: []BookedRange{},
+		Blocked: []Blackout{},
+	}
+
+	err := db.DB.QueryRow("SELECT i_quantity FROM items WHERE i_id = $1", itemID).Scan(&a.Quantity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Availability{}, ErrNotFound
+	}
+	if err != nil {
+		return Availability{}, fmt.Errorf("error querying item: %v", err)
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT start_date, end_date, status
+		FROM rentals
+		WHERE item_id = $1
+		AND status IN ($2, $3, $6)
+		AND start_date < $5
+		AND end_date > $4
+		ORDER BY start_date`, itemID, RentalApproved, RentalPending, from, to, RentalActive)
+	if err != nil {
+		return Availability{}, fmt.Errorf("error querying rentals: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b BookedRange
+		var status string
+		if err := rows.Scan(&b.StartDate, &b.EndDate, &status); err != nil {
+			return Availability{}, fmt.Errorf("error scanning rental: %v", err)
+		}
+		if status == RentalApproved || status == RentalActive {
+			a.Booked = append(a.Booked, b)
+		} else {
+			a.Pending = append(a.Pending, b)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Availability{}, fmt.Errorf("error scanning rentals: %v", err)
+	}
+
+	blackouts, err := db.DB.Query(`
+		SELECT b_id, i_id, start_date, end_date, reason
+		FROM item_blackouts
+		WHERE i_id = $1
+		AND start_date < $3
+		AND end_date > $2
+		ORDER BY start_date`, itemID, from, to)
+	if err != nil {
+		return Availability{}, fmt.Errorf("error querying blackouts: %v", err)
+	}
+	defer blackouts.Close()
+
+	for blackouts.Next() {
+		var b Blackout
+		if err := blackouts.Scan(&b.ID, &b.ItemID, &b.StartDate, &b.EndDate, &b.Reason); err != nil {
+			return Availability{}, fmt.Errorf("error scanning blackout: %v", err)
+		}
+		a.Blocked = append(a.Blocked, b)
+	}
+	if err := blackouts.Err(); err != nil {
+		return Availability{}, fmt.Errorf("error scanning blackouts: %v", err)
+	}
+
+	return a, nil
+}
+
+// -------------- Add a blackout period to an item --------------
+// Only the item's owner can block its dates, someone else's item is reported as not found.
+func CreateBlackout(b *Blackout, ownerID int64) error {
+	if !b.StartDate.Before(b.EndDate) {
+		return ErrInvalidDates
+	}
+
+	var owned bool
+	if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM items WHERE i_id = $1 AND owner_id = $2)", b.ItemID, ownerID).Scan(&owned); err != nil {
+		return fmt.Errorf("error querying item: %v", err)
+	}
+	if !owned {
+		return ErrNotFound
+	}
+
+	// Blocking dates someone already has an approved booking for would strand the renter
+	var conflict OverlapError
+	err := db.DB.QueryRow(`
+		SELECT start_date, end_date
+		FROM rentals
+		WHERE item_id = $1
+		AND status IN ($2, $5)
+		AND start_date < $4
+		AND end_date > $3
+		ORDER BY start_date
+		LIMIT 1`, b.ItemID, RentalApproved, b.StartDate, b.EndDate, RentalActive).Scan(&conflict.Start, &conflict.End)
+	if err == nil {
+		return &conflict
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error querying rentals: %v", err)
+	}
+
+	err = db.DB.QueryRow(`
+		INSERT INTO item_blackouts (i_id, start_date, end_date, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING b_id`, b.ItemID, b.StartDate, b.EndDate, b.Reason).Scan(&b.ID)
+	if err != nil {
+		return fmt.Errorf("error creating blackout: %v", err)
+	}
+	return nil
+}
+
+// -------------- Remove a blackout period from an item --------------
+func DeleteBlackout(itemID, blackoutID, ownerID int64) (bool, error) {
+	result, err := db.DB.Exec(`
+		DELETE FROM item_blackouts
+		WHERE b_id = $1 AND i_id = $2
+		AND i_id IN (SELECT i_id FROM items WHERE owner_id = $3)`, blackoutID, itemID, ownerID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting blackout: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
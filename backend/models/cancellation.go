@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Cancellation policies, matching the CHECK constraint on items.i_cancellation_policy
+const (
+	PolicyFlexible = "flexible"
+	PolicyModerate = "moderate"
+	PolicyStrict   = "strict"
+)
+
+// refundTier refunds Percent of the total when the renter cancels at least Notice before the start
+type refundTier struct {
+	Notice  time.Duration
+	Percent int64
+}
+
+// cancellationPolicies lists each policy's tiers, longest notice first. Cancelling with less
+// notice than the last tier refunds nothing.
+var cancellationPolicies = map[string][]refundTier{
+	PolicyFlexible: {
+		{Notice: 24 * time.Hour, Percent: 100},
+		{Notice: 0, Percent: 50},
+	},
+	PolicyModerate: {
+		{Notice: 5 * 24 * time.Hour, Percent: 100},
+		{Notice: 24 * time.Hour, Percent: 50},
+	},
+	PolicyStrict: {
+		{Notice: 7 * 24 * time.Hour, Percent: 50},
+	},
+}
+
+// ValidCancellationPolicy reports whether policy is one of the Policy* values
+func ValidCancellationPolicy(policy string) bool {
+	_, ok := cancellationPolicies[policy]
+	return ok
+}
+
+// Refund is what cancelling an approved rental gives back to the renter
+type Refund struct {
+	Policy  string `json:"policy"`
+	Percent int64  `json:"percent"`
+	Amount  int64  `json:"amount"` // cents of total_price, the deposit always comes back in full
+}
+
+// RefundPercent is how much of the total a renter gets back for cancelling at now.
+// Owners cancelling always refund everything.
+func RefundPercent(policy, party string, now, start time.Time) int64 {
+	if party == PartyOwner {
+		return 100
+	}
+	notice := start.Sub(now)
+	for _, tier := range cancellationPolicies[policy] {
+		if notice >= tier.Notice {
+			return tier.Percent
+		}
+	}
+	return 0
+}
+
+// CalculateRefund prices the cancellation of an approved rental, rounding down to the cent
+func CalculateRefund(rental Rental, party string, now time.Time) Refund {
+	percent := RefundPercent(rental.CancellationPolicy, party, now, rental.StartDate)
+	return Refund{
+		Policy:  rental.CancellationPolicy,
+		Percent: percent,
+		Amount:  rental.TotalPrice * percent / 100,
+	}
+}
+
+// -------------- Preview what cancelling an approved rental would refund --------------
+func PreviewRefund(rentalID, userID int64) (Refund, error) {
+	rental, err := GetRental(rentalID)
+	if err != nil {
+		return Refund{}, err
+	}
+	party := rental.PartyOf(userID)
+	if party == "" {
+		return Refund{}, ErrForbidden
+	}
+	if rental.Status != RentalApproved {
+		return Refund{}, ErrIllegalTransition
+	}
+	return CalculateRefund(rental, party, time.Now()), nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxMessageLength caps a message body, in characters
+const MaxMessageLength = 4000
+
+// Page sizes for message history
+const (
+	DefaultMessagePage = 50
+	MaxMessagePage     = 100
+)
+
+// ErrInvalidMessage is returned for an empty message or one longer than MaxMessageLength
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Conversation is a thread between an item's owner and a renter, about an item or a rental
+type Conversation struct {
+	ID            int64      `json:"id"`
+	ItemID        int64      `json:"item_id"`
+	ItemName      string     `json:"item_name"`
+	RentalID      *int64     `json:"rental_id,omitempty"` // nil for questions about the item
+	OwnerID       int64      `json:"owner_id"`
+	RenterID      int64      `json:"renter_id"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"` // nil until the first message
+	CreatedAt     time.Time  `json:"created_at"`
+	LastMessage   *Message   `json:"last_message,omitempty"`
+	UnreadCount   int        `json:"unread_count"` // messages from the other participant the current user hasn't read
+}
+
+// OtherParticipant is the participant who isn't userID
+func (c Conversation) OtherParticipant(userID int64) int64 {
+	if userID == c.OwnerID {
+		return c.RenterID
+	}
+	return c.OwnerID
+}
+
+// IsParticipant reports whether userID is one of the two participants
+func (c Conversation) IsParticipant(userID int64) bool {
+	return userID == c.OwnerID || userID == c.RenterID
+}
+
+type Message struct {
+	ID             int64      `json:"id"`
+	ConversationID int64      `json:"conversation_id"`
+	SenderID       int64      `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"` // read receipt, nil while unread
+}
+
+// MessagePage is one page of a conversation's history, newest first
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextBefore *int64    `json:"next_before,omitempty"` // pass as ?before= for older messages, nil on the last page
+}
+
+// Parse the body of POST /conversations, exactly one of the IDs is set
+type ConversationRequest struct {
+	ItemID   *int64 `json:"item_id"`
+	RentalID *int64 `json:"rental_id"`
+}
+
+// Parse the body of POST /conversations/{id}/messages
+type MessageRequest struct {
+	Body string `json:"body"`
+}
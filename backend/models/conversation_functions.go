@@ -0,0 +1,304 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// ErrInvalidConversation is returned when a new conversation names both or neither of an item and a rental
+var ErrInvalidConversation = errors.New("conversation needs an item or a rental")
+
+// conversationSelect takes the viewing user as $1, for the unread count
+const conversationSelect = `
+	SELECT
+		c.c_id,
+		c.item_id,
+		i.i_name,
+		c.rental_id,
+		c.owner_id,
+		c.renter_id,
+		c.last_message_at,
+		c.created_at,
+		lm.m_id,
+		lm.sender_id,
+		lm.body,
+		lm.created_at,
+		lm.read_at,
+		(SELECT COUNT(*) FROM messages um WHERE um.c_id = c.c_id AND um.sender_id <> $1 AND um.read_at IS NULL)
+	FROM conversations c
+	JOIN items i ON c.item_id = i.i_id
+	LEFT JOIN LATERAL (
+		SELECT m_id, sender_id, body, created_at, read_at
+		FROM messages
+		WHERE c_id = c.c_id
+		ORDER BY m_id DESC
+		LIMIT 1
+	) lm ON TRUE`
+
+func scanConversation(row rowScanner) (Conversation, error) {
+	var c Conversation
+	var (
+		lastID, lastSender sql.NullInt64
+		lastBody           sql.NullString
+		lastCreated        sql.NullTime
+		lastRead           *time.Time
+	)
+	err := row.Scan(
+		&c.ID,
+		&c.ItemID,
+		&c.ItemName,
+		&c.RentalID,
+		&c.OwnerID,
+		&c.RenterID,
+		&c.LastMessageAt,
+		&c.CreatedAt,
+		&lastID,
+		&lastSender,
+		&lastBody,
+		&lastCreated,
+		&lastRead,
+		&c.UnreadCount,
+	)
+	if lastID.Valid {
+		c.LastMessage = &Message{
+			ID:             lastID.Int64,
+			ConversationID: c.ID,
+			SenderID:       lastSender.Int64,
+			Body:           lastBody.String,
+			CreatedAt:      lastCreated.Time,
+			ReadAt:         lastRead,
+		}
+	}
+	return c, err
+}
+
+const messageSelect = `
+	SELECT m_id, c_id, sender_id, body, created_at, read_at
+	FROM messages`
+
+func scanMessage(row rowScanner) (Message, error) {
+	var m Message
+	err := row.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Body, &m.CreatedAt, &m.ReadAt)
+	return m, err
+}
+
+// -------------- Start (or reopen) a conversation about an item or a rental --------------
+// Item threads are between the owner and the user asking, who can't be the owner. Rental
+// threads are between the rental's parties. Asking again returns the existing thread;
+// created reports whether it is new.
+func StartConversation(userID int64, req ConversationRequest) (Conversation, bool, error) {
+	if (req.ItemID == nil) == (req.RentalID == nil) {
+		return Conversation{}, false, ErrInvalidConversation
+	}
+
+	var itemID, ownerID, renterID int64
+	if req.RentalID != nil {
+		rental, err := GetRental(*req.RentalID)
+		if err != nil {
+			return Conversation{}, false, err
+		}
+		if rental.PartyOf(userID) == "" {
+			return Conversation{}, false, ErrForbidden
+		}
+		itemID, ownerID, renterID = rental.ItemID, rental.OwnerID, rental.RenterID
+	} else {
+		id, err := GetItemOwnerID(*req.ItemID)
+		if err != nil {
+			return Conversation{}, false, err
+		}
+		if id == userID {
+			return Conversation{}, false, ErrForbidden
+		}
+		itemID, ownerID, renterID = *req.ItemID, id, userID
+	}
+
+	var id int64
+	var err error
+	if req.RentalID != nil {
+		err = db.DB.QueryRow(`
+			INSERT INTO conversations (item_id, rental_id, owner_id, renter_id)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (rental_id) WHERE rental_id IS NOT NULL DO NOTHING
+			RETURNING c_id`, itemID, *req.RentalID, ownerID, renterID).Scan(&id)
+	} else {
+		err = db.DB.QueryRow(`
+			INSERT INTO conversations (item_id, owner_id, renter_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (item_id, renter_id) WHERE rental_id IS NULL DO NOTHING
+			RETURNING c_id`, itemID, ownerID, renterID).Scan(&id)
+	}
+	created := err == nil
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already there, look it up
+		if req.RentalID != nil {
+			err = db.DB.QueryRow("SELECT c_id FROM conversations WHERE rental_id = $1", *req.RentalID).Scan(&id)
+		} else {
+			err = db.DB.QueryRow("SELECT c_id FROM conversations WHERE item_id = $1 AND renter_id = $2 AND rental_id IS NULL", itemID, renterID).Scan(&id)
+		}
+	}
+	if err != nil {
+		return Conversation{}, false, fmt.Errorf("error creating conversation: %v", err)
+	}
+
+	c, err := GetConversation(id, userID)
+	return c, created, err
+}
+
+// -------------- Get the user's conversations, most recent activity first --------------
+func GetConversations(userID int64) ([]Conversation, error) {
+	rows, err := db.DB.Query(conversationSelect+`
+		WHERE c.owner_id = $1 OR c.renter_id = $1
+		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying conversations: %v", err)
+	}
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning conversation: %v", err)
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// -------------- Get one of the user's conversations --------------
+func GetConversation(id, userID int64) (Conversation, error) {
+	c, err := scanConversation(db.DB.QueryRow(conversationSelect+" WHERE c.c_id = $2", userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Conversation{}, ErrNotFound
+	}
+	if err != nil {
+		return Conversation{}, fmt.Errorf("error querying conversation: %v", err)
+	}
+	if !c.IsParticipant(userID) {
+		return Conversation{}, ErrForbidden
+	}
+	return c, nil
+}
+
+// -------------- Get a page of a conversation's messages, newest first --------------
+// before is the ID of the oldest message already shown, 0 for the latest page.
+func GetMessages(conversationID, userID, before int64, limit int) (MessagePage, error) {
+	if _, err := GetConversation(conversationID, userID); err != nil {
+		return MessagePage{}, err
+	}
+
+	query := messageSelect + " WHERE c_id = $1"
+	args := []interface{}{conversationID}
+	if before > 0 {
+		query += " AND m_id < $2"
+		args = append(args, before)
+	}
+	// One extra row tells whether there is an older page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY m_id DESC LIMIT $%d", len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return MessagePage{}, fmt.Errorf("error querying messages: %v", err)
+	}
+	defer rows.Close()
+
+	page := MessagePage{Messages: []Message{}}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return MessagePage{}, fmt.Errorf("error scanning message: %v", err)
+		}
+		page.Messages = append(page.Messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return MessagePage{}, fmt.Errorf("error scanning messages: %v", err)
+	}
+
+	if len(page.Messages) > limit {
+		page.Messages = page.Messages[:limit]
+		page.NextBefore = &page.Messages[limit-1].ID
+	}
+	return page, nil
+}
+
+// -------------- Send a message to the other participant --------------
+func SendMessage(conversationID, userID int64, body string) (Message, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > MaxMessageLength {
+		return Message{}, ErrInvalidMessage
+	}
+	c, err := GetConversation(conversationID, userID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Message{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	m, err := scanMessage(tx.QueryRow(`
+		INSERT INTO messages (c_id, sender_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING m_id, c_id, sender_id, body, created_at, read_at`, conversationID, userID, body))
+	if err != nil {
+		return Message{}, fmt.Errorf("error creating message: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE conversations SET last_message_at = $1 WHERE c_id = $2", m.CreatedAt, conversationID); err != nil {
+		return Message{}, fmt.Errorf("error updating conversation: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Message{}, fmt.Errorf("error committing message: %v", err)
+	}
+	publishMessage(c, m)
+	return m, nil
+}
+
+// -------------- Mark everything the other participant sent as read --------------
+// Returns how many messages were newly read. Their read_at is the sender's read receipt.
+func MarkConversationRead(conversationID, userID int64) (int64, error) {
+	c, err := GetConversation(conversationID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := db.DB.Exec(`
+		UPDATE messages SET read_at = CURRENT_TIMESTAMP
+		WHERE c_id = $1 AND sender_id <> $2 AND read_at IS NULL`, conversationID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error marking messages read: %v", err)
+	}
+	read, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error marking messages read: %v", err)
+	}
+	if read > 0 {
+		publishRead(c, userID, read)
+	}
+	return read, nil
+}
+
+// -------------- Count the user's unread messages across all conversations --------------
+func GetUnreadMessageCount(userID int64) (int, error) {
+	var count int
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN conversations c ON m.c_id = c.c_id
+		WHERE (c.owner_id = $1 OR c.renter_id = $1)
+		AND m.sender_id <> $1
+		AND m.read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Damage claim statuses, matching the CHECK constraint on damage_claims.status
+const (
+	ClaimOpen      = "open"      // waiting for the renter to respond
+	ClaimAccepted  = "accepted"  // the renter agreed, the amount was taken from the deposit
+	ClaimContested = "contested" // the renter disagreed, waiting for a moderator
+	ClaimResolved  = "resolved"  // a moderator decided the amount
+)
+
+// MaxClaimEvidence caps how many photos one damage claim can have
+const MaxClaimEvidence = 10
+
+type DamageClaim struct {
+	ID             int64           `json:"id"`
+	RentalID       int64           `json:"rental_id"`
+	ItemID         int64           `json:"item_id"`
+	OwnerID        int64           `json:"owner_id"`
+	RenterID       int64           `json:"renter_id"`
+	Amount         int64           `json:"amount"`
+	Description    string          `json:"description"`
+	Status         string          `json:"status"`
+	RenterResponse *string         `json:"renter_response,omitempty"` // nullable
+	RespondedAt    *time.Time      `json:"responded_at,omitempty"`    // nullable
+	CapturedAmount *int64          `json:"captured_amount,omitempty"` // set once the deposit is settled
+	ResolvedBy     *int64          `json:"resolved_by,omitempty"`     // the moderator, nullable
+	ResolvedAt     *time.Time      `json:"resolved_at,omitempty"`     // nullable
+	CreatedAt      time.Time       `json:"created_at"`
+	Evidence       []ClaimEvidence `json:"evidence"`
+}
+
+type ClaimEvidence struct {
+	ID          int64     `json:"id"`
+	ClaimID     int64     `json:"claim_id"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	StorageKey  string    `json:"-"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EvidenceURL is where a claim's evidence photo is served
+func EvidenceURL(claimID, evidenceID int64) string {
+	return fmt.Sprintf("/api/claims/%d/evidence/%d", claimID, evidenceID)
+}
+
+// Parse the request body of a new damage claim, amount is in cents and at most the deposit
+type ClaimRequest struct {
+	Amount      int64  `json:"amount"`
+	Description string `json:"description"`
+}
+
+// Parse the renter's answer to a damage claim
+type ClaimResponseRequest struct {
+	Accept   bool   `json:"accept"`
+	Response string `json:"response"`
+}
+
+// Parse a moderator's ruling on a contested claim, 0 releases the whole deposit
+type ClaimResolutionRequest struct {
+	Amount int64 `json:"amount"`
+}
@@ -0,0 +1,379 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/lib/pq"
+)
+
+// ErrNoDeposit is returned when a claim is filed against a rental without a held deposit
+var ErrNoDeposit = errors.New("rental has no held deposit")
+
+// ErrInvalidClaim is returned for a claim without a description or with an amount outside 1..deposit
+var ErrInvalidClaim = errors.New("invalid damage claim")
+
+// ErrClaimExists is returned when the rental already has a damage claim
+var ErrClaimExists = errors.New("rental already has a damage claim")
+
+// ErrClaimClosed is returned when a claim is no longer waiting on the requested step
+var ErrClaimClosed = errors.New("damage claim is closed")
+
+// ErrClaimPending is returned when an approved rental with an undecided claim is cancelled
+var ErrClaimPending = errors.New("rental has a pending damage claim")
+
+// ErrTooMuchEvidence is returned when a claim already has MaxClaimEvidence photos
+var ErrTooMuchEvidence = errors.New("too many evidence photos for this claim")
+
+const claimSelect = `
+	SELECT
+		dc.dc_id,
+		dc.rental_id,
+		r.item_id,
+		i.owner_id,
+		r.renter_id,
+		dc.amount,
+		dc.description,
+		dc.status,
+		dc.renter_response,
+		dc.responded_at,
+		dc.captured_amount,
+		dc.resolved_by,
+		dc.resolved_at,
+		dc.created_at
+	FROM damage_claims dc
+	JOIN rentals r ON dc.rental_id = r.rental_id
+	JOIN items i ON r.item_id = i.i_id`
+
+func scanClaim(row rowScanner) (DamageClaim, error) {
+	var c DamageClaim
+	err := row.Scan(
+		&c.ID,
+		&c.RentalID,
+		&c.ItemID,
+		&c.OwnerID,
+		&c.RenterID,
+		&c.Amount,
+		&c.Description,
+		&c.Status,
+		&c.RenterResponse,
+		&c.RespondedAt,
+		&c.CapturedAmount,
+		&c.ResolvedBy,
+		&c.ResolvedAt,
+		&c.CreatedAt,
+	)
+	c.Evidence = []ClaimEvidence{}
+	return c, err
+}
+
+// lockClaimRental loads a claim and locks its rental, the rental row guards the deposit
+func lockClaimRental(tx *sql.Tx, claimID int64) (DamageClaim, Rental, error) {
+	claim, err := scanClaim(tx.QueryRow(claimSelect+" WHERE dc.dc_id = $1", claimID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DamageClaim{}, Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return DamageClaim{}, Rental{}, fmt.Errorf("error querying damage claim: %v", err)
+	}
+
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", claim.RentalID))
+	if err != nil {
+		return DamageClaim{}, Rental{}, fmt.Errorf("error locking rental: %v", err)
+	}
+
+	// Re-read under the lock, another request may have settled it meanwhile
+	claim, err = scanClaim(tx.QueryRow(claimSelect+" WHERE dc.dc_id = $1", claimID))
+	if err != nil {
+		return DamageClaim{}, Rental{}, fmt.Errorf("error querying damage claim: %v", err)
+	}
+	return claim, rental, nil
+}
+
+// -------------- Owner files a damage claim against a rental's deposit --------------
+func CreateDamageClaim(rentalID, ownerID int64, req ClaimRequest) (DamageClaim, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DamageClaim{}, ErrNotFound
+	}
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error querying rental: %v", err)
+	}
+	if rental.OwnerID != ownerID {
+		return DamageClaim{}, ErrForbidden
+	}
+	// Nothing can be damaged before the checkout, and the checkin releases the deposit
+	if rental.Status != RentalActive {
+		return DamageClaim{}, ErrIllegalTransition
+	}
+	if rental.DepositStatus != DepositHeld {
+		return DamageClaim{}, ErrNoDeposit
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if req.Amount <= 0 || req.Amount > rental.Deposit || req.Description == "" {
+		return DamageClaim{}, ErrInvalidClaim
+	}
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO damage_claims (rental_id, amount, description)
+		VALUES ($1, $2, $3)
+		RETURNING dc_id`, rentalID, req.Amount, req.Description).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return DamageClaim{}, ErrClaimExists
+		}
+		return DamageClaim{}, fmt.Errorf("error creating damage claim: %v", err)
+	}
+
+	claim, err := scanClaim(tx.QueryRow(claimSelect+" WHERE dc.dc_id = $1", id))
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error querying damage claim: %v", err)
+	}
+
+	err = notify(tx, Notification{
+		UserID:   rental.RenterID,
+		Kind:     NotifyDamageClaimFiled,
+		Title:    fmt.Sprintf("A damage claim of %s was filed on %s", formatCents(req.Amount), rental.ItemName),
+		Body:     "Accept it or contest it, a moderator decides contested claims.",
+		RentalID: &rental.ID,
+	})
+	if err != nil {
+		return DamageClaim{}, err
+	}
+	return claim, tx.Commit()
+}
+
+// -------------- Renter accepts or contests a damage claim --------------
+func RespondToDamageClaim(claimID, renterID int64, req ClaimResponseRequest) (DamageClaim, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	claim, rental, err := lockClaimRental(tx, claimID)
+	if err != nil {
+		return DamageClaim{}, err
+	}
+	if claim.RenterID != renterID {
+		return DamageClaim{}, ErrForbidden
+	}
+	if claim.Status != ClaimOpen {
+		return DamageClaim{}, ErrClaimClosed
+	}
+
+	status := ClaimContested
+	var captured *int64
+	if req.Accept {
+		status = ClaimAccepted
+		captured = &claim.Amount
+		if err := settleDeposit(tx, &rental, claim.Amount); err != nil {
+			return DamageClaim{}, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE damage_claims
+		SET status = $1, renter_response = NULLIF($2, ''), responded_at = CURRENT_TIMESTAMP, captured_amount = $3
+		WHERE dc_id = $4`, status, strings.TrimSpace(req.Response), captured, claimID)
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error updating damage claim: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DamageClaim{}, fmt.Errorf("error committing damage claim: %v", err)
+	}
+	settlePayments(rental.ID)
+	return GetDamageClaim(claimID)
+}
+
+// -------------- Moderator decides how much of the deposit a claim takes --------------
+func ResolveDamageClaim(claimID, moderatorID int64, req ClaimResolutionRequest) (DamageClaim, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	claim, rental, err := lockClaimRental(tx, claimID)
+	if err != nil {
+		return DamageClaim{}, err
+	}
+	// Nobody rules on their own rental
+	if moderatorID == rental.RenterID || moderatorID == rental.OwnerID {
+		return DamageClaim{}, ErrForbidden
+	}
+	// Open claims can be resolved too, for renters who never answer
+	if claim.Status != ClaimOpen && claim.Status != ClaimContested {
+		return DamageClaim{}, ErrClaimClosed
+	}
+	if req.Amount < 0 || req.Amount > claim.Amount {
+		return DamageClaim{}, ErrInvalidClaim
+	}
+
+	if err := settleDeposit(tx, &rental, req.Amount); err != nil {
+		return DamageClaim{}, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE damage_claims
+		SET status = $1, captured_amount = $2, resolved_by = $3, resolved_at = CURRENT_TIMESTAMP
+		WHERE dc_id = $4`, ClaimResolved, req.Amount, moderatorID, claimID)
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error updating damage claim: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return DamageClaim{}, fmt.Errorf("error committing damage claim: %v", err)
+	}
+	settlePayments(rental.ID)
+	return GetDamageClaim(claimID)
+}
+
+// -------------- Get a damage claim with its evidence --------------
+func GetDamageClaim(claimID int64) (DamageClaim, error) {
+	claim, err := scanClaim(db.DB.QueryRow(claimSelect+" WHERE dc.dc_id = $1", claimID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DamageClaim{}, ErrNotFound
+	}
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error querying damage claim: %v", err)
+	}
+
+	rows, err := db.DB.Query(claimEvidenceSelect+" WHERE dc_id = $1 ORDER BY ev_id", claimID)
+	if err != nil {
+		return DamageClaim{}, fmt.Errorf("error querying claim evidence: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ev, err := scanClaimEvidence(rows)
+		if err != nil {
+			return DamageClaim{}, fmt.Errorf("error scanning claim evidence: %v", err)
+		}
+		claim.Evidence = append(claim.Evidence, ev)
+	}
+	return claim, rows.Err()
+}
+
+// -------------- Get damage claims by status, for moderators --------------
+func GetDamageClaims(status string) ([]DamageClaim, error) {
+	query := claimSelect
+	var args []interface{}
+	if status != "" {
+		query += " WHERE dc.status = $1"
+		args = append(args, status)
+	}
+	query += " ORDER BY dc.created_at"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying damage claims: %v", err)
+	}
+	defer rows.Close()
+
+	claims := []DamageClaim{}
+	for rows.Next() {
+		c, err := scanClaim(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning damage claim: %v", err)
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// ValidClaimStatus reports whether status is one of the Claim* statuses
+func ValidClaimStatus(status string) bool {
+	switch status {
+	case ClaimOpen, ClaimAccepted, ClaimContested, ClaimResolved:
+		return true
+	}
+	return false
+}
+
+// -------------- Claim evidence photos --------------
+
+const claimEvidenceSelect = `
+	SELECT ev_id, dc_id, content_type, size_bytes, storage_key, created_at
+	FROM damage_claim_evidence`
+
+func scanClaimEvidence(row rowScanner) (ClaimEvidence, error) {
+	var ev ClaimEvidence
+	err := row.Scan(&ev.ID, &ev.ClaimID, &ev.ContentType, &ev.Size, &ev.StorageKey, &ev.CreatedAt)
+	ev.URL = EvidenceURL(ev.ClaimID, ev.ID)
+	return ev, err
+}
+
+// AddClaimEvidence records a batch of stored evidence photos, only while the claim is open.
+// The batch is recorded whole or not at all, so a failed upload can be retried as is.
+func AddClaimEvidence(evidence []ClaimEvidence) error {
+	if len(evidence) == 0 {
+		return nil
+	}
+	claimID := evidence[0].ClaimID
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the claim so concurrent uploads can't pass the cap together
+	var status string
+	var count int
+	err = tx.QueryRow(`
+		SELECT status, (SELECT COUNT(*) FROM damage_claim_evidence ev WHERE ev.dc_id = dc.dc_id)
+		FROM damage_claims dc
+		WHERE dc.dc_id = $1
+		FOR UPDATE`, claimID).Scan(&status, &count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error locking damage claim: %v", err)
+	}
+	if status != ClaimOpen {
+		return ErrClaimClosed
+	}
+	if count+len(evidence) > MaxClaimEvidence {
+		return ErrTooMuchEvidence
+	}
+
+	for i := range evidence {
+		ev := &evidence[i]
+		err = tx.QueryRow(`
+			INSERT INTO damage_claim_evidence (dc_id, content_type, size_bytes, storage_key)
+			VALUES ($1, $2, $3, $4)
+			RETURNING ev_id, created_at`, claimID, ev.ContentType, ev.Size, ev.StorageKey).
+			Scan(&ev.ID, &ev.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error creating claim evidence: %v", err)
+		}
+		ev.ClaimID = claimID
+		ev.URL = EvidenceURL(claimID, ev.ID)
+	}
+	return tx.Commit()
+}
+
+func GetClaimEvidence(claimID, evidenceID int64) (ClaimEvidence, error) {
+	ev, err := scanClaimEvidence(db.DB.QueryRow(claimEvidenceSelect+" WHERE dc_id = $1 AND ev_id = $2", claimID, evidenceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ClaimEvidence{}, ErrNotFound
+	}
+	if err != nil {
+		return ClaimEvidence{}, fmt.Errorf("error querying claim evidence: %v", err)
+	}
+	return ev, nil
+}
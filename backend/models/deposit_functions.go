@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/LuaanNguyen/backend/payments"
+)
+
+// depositReference identifies a rental's deposit hold to the payment provider
+func depositReference(rental Rental) string {
+	return rentalReference(rental) + "-deposit"
+}
+
+// holdDeposit authorizes the rental's deposit on the renter's payment method
+func holdDeposit(tx *sql.Tx, rental *Rental) error {
+	if rental.Deposit <= 0 {
+		return nil
+	}
+
+	paymentID, err := payments.Default.Authorize(rental.RenterID, rental.Deposit, depositReference(*rental))
+	if err != nil {
+		return paymentError("holding deposit", err)
+	}
+	rental.DepositPaymentID = &paymentID
+	rental.DepositStatus = DepositHeld
+
+	_, err = tx.Exec(`
+		UPDATE rentals SET deposit_payment_id = $1, deposit_status = $2
+		WHERE rental_id = $3`, paymentID, DepositHeld, rental.ID)
+	if err != nil {
+		return fmt.Errorf("error saving deposit hold: %v", err)
+	}
+	return postTransaction(tx, &rental.RenterID, TxDepositHold, *rental, rental.Deposit, rental.DepositPaymentID)
+}
+
+// settleDeposit takes captured out of the held deposit for the owner and gives the rest back
+// to the renter. captured 0 is a plain release. Capturing part of the hold releases the rest.
+func settleDeposit(tx *sql.Tx, rental *Rental, captured int64) error {
+	if rental.DepositStatus != DepositHeld || rental.DepositPaymentID == nil {
+		return nil
+	}
+
+	if captured > 0 {
+		if err := queueCapture(tx, *rental, *rental.DepositPaymentID, captured, "deposit-capture"); err != nil {
+			return err
+		}
+		if err := postTransaction(tx, &rental.RenterID, TxDepositCapture, *rental, captured, rental.DepositPaymentID); err != nil {
+			return err
+		}
+		if err := postPayout(tx, *rental, captured, "deposit-payout"); err != nil {
+			return err
+		}
+	}
+
+	if captured == 0 {
+		if err := queueRelease(tx, *rental, *rental.DepositPaymentID, rental.Deposit, "deposit-release"); err != nil {
+			return err
+		}
+	}
+	if remainder := rental.Deposit - captured; remainder > 0 {
+		if err := postTransaction(tx, &rental.RenterID, TxDepositRelease, *rental, remainder, rental.DepositPaymentID); err != nil {
+			return err
+		}
+	}
+
+	rental.DepositStatus = DepositReleased
+	if captured > 0 {
+		rental.DepositStatus = DepositClaimed
+	}
+	if _, err := tx.Exec("UPDATE rentals SET deposit_status = $1 WHERE rental_id = $2", rental.DepositStatus, rental.ID); err != nil {
+		return fmt.Errorf("error updating deposit status: %v", err)
+	}
+	return nil
+}
+
+// hasPendingClaim reports whether the rental has a damage claim still waiting on a decision
+func hasPendingClaim(tx *sql.Tx, rentalID int64) (bool, error) {
+	var pending bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM damage_claims WHERE rental_id = $1 AND status IN ($2, $3))`,
+		rentalID, ClaimOpen, ClaimContested).Scan(&pending)
+	if err != nil {
+		return false, fmt.Errorf("error querying damage claims: %v", err)
+	}
+	return pending, nil
+}
+
+// releaseHolds gives back what an approval authorized, for when the approval doesn't go through
+func releaseHolds(rental Rental) {
+	if rental.PaymentID != nil {
+		releaseAuthorization(rental, *rental.PaymentID, rental.TotalPrice, "hold-release")
+	}
+	if rental.DepositPaymentID != nil {
+		releaseAuthorization(rental, *rental.DepositPaymentID, rental.Deposit, "deposit-hold-release")
+	}
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/LuaanNguyen/backend/notifications"
+	"github.com/lib/pq"
+)
+
+// -------------- Email the daily digests that are due --------------
+// A user's digest is due once a day from DigestHour in their time zone, outside their quiet
+// hours, while they have notifications set to digest. Returns how many digests were sent;
+// users whose digest failed are skipped and their errors returned together.
+func SendDigests(now time.Time) (int, error) {
+	channel := notifications.Lookup("email")
+	if channel == nil {
+		return 0, ErrNotificationChannel
+	}
+
+	rows, err := db.DB.Query("SELECT DISTINCT u_id FROM notifications WHERE digest_pending")
+	if err != nil {
+		return 0, fmt.Errorf("error querying digests: %v", err)
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning digest: %v", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error scanning digests: %v", err)
+	}
+
+	sent := 0
+	var errs []error
+	for _, userID := range userIDs {
+		ok, err := sendDigest(channel, userID, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %d: %v", userID, err))
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// digest is a user's daily digest, claimed and waiting to be emailed
+type digest struct {
+	userID   int64
+	email    string
+	pending  []Notification
+	loc      *time.Location
+	today    string         // the user's local date, saved as last_digest_on
+	previous sql.NullString // last_digest_on before the claim
+}
+
+// sendDigest emails the user's pending notifications if their digest is due. The claim is
+// committed before the email goes out, so a slow mail server holds no locks; a failed send
+// flags the notifications pending again so the next run retries them.
+func sendDigest(channel notifications.Channel, userID int64, now time.Time) (bool, error) {
+	d, err := claimDigest(userID, now)
+	if err != nil || d == nil {
+		return false, err
+	}
+	if err := deliverDigest(channel, *d, now); err != nil {
+		if releaseErr := releaseDigest(*d); releaseErr != nil {
+			return false, fmt.Errorf("%v, and %v", err, releaseErr)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// claimDigest clears the pending flags of a user whose digest is due and records today's
+// digest. Returns nil if nothing is due or there is nothing to email.
+func claimDigest(userID int64, now time.Time) (*digest, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The settings row is the lock that keeps two dispatchers from claiming the same digest
+	if _, err := tx.Exec("INSERT INTO notification_settings (u_id) VALUES ($1) ON CONFLICT (u_id) DO NOTHING", userID); err != nil {
+		return nil, fmt.Errorf("error creating notification settings: %v", err)
+	}
+	d := digest{userID: userID}
+	err = tx.QueryRow(`
+		SELECT to_char(last_digest_on, 'YYYY-MM-DD') FROM notification_settings
+		WHERE u_id = $1 FOR UPDATE SKIP LOCKED`, userID).Scan(&d.previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying last digest: %v", err)
+	}
+
+	settings, err := loadSettings(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	d.loc = settings.location()
+	local := now.In(d.loc)
+	d.today = local.Format("2006-01-02")
+	if local.Hour() < DigestHour || (d.previous.Valid && d.previous.String >= d.today) {
+		return nil, nil
+	}
+	if _, quiet := settings.quietUntil(now); quiet {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(`
+		UPDATE notifications SET digest_pending = FALSE
+		WHERE u_id = $1 AND digest_pending
+		RETURNING n_id, u_id, kind, title, body, rental_id, created_at, read_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming digest notifications: %v", err)
+	}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning digest notification: %v", err)
+		}
+		// Whatever was already read in the app isn't news any more
+		if n.ReadAt == nil {
+			d.pending = append(d.pending, n)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning digest notifications: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE notification_settings SET last_digest_on = $1 WHERE u_id = $2", d.today, userID); err != nil {
+		return nil, fmt.Errorf("error recording digest: %v", err)
+	}
+	if err := tx.QueryRow("SELECT COALESCE(u_email, '') FROM users WHERE u_id = $1", userID).Scan(&d.email); err != nil {
+		return nil, fmt.Errorf("error querying user email: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing digest: %v", err)
+	}
+	if len(d.pending) == 0 || d.email == "" {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+// deliverDigest emails a claimed digest
+func deliverDigest(channel notifications.Channel, d digest, now time.Time) error {
+	return channel.Send(digestMessage(d.userID, d.email, d.pending, d.loc, now))
+}
+
+// releaseDigest undoes the claim of a digest that couldn't be sent. The notifications only
+// go back to pending while unread, and last_digest_on only if no later digest went out.
+func releaseDigest(d digest) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, len(d.pending))
+	for i, n := range d.pending {
+		ids[i] = n.ID
+	}
+	if _, err := tx.Exec("UPDATE notifications SET digest_pending = TRUE WHERE n_id = ANY($1) AND read_at IS NULL", pq.Array(ids)); err != nil {
+		return fmt.Errorf("error flagging digest notifications: %v", err)
+	}
+	_, err = tx.Exec(`
+		UPDATE notification_settings SET last_digest_on = $1
+		WHERE u_id = $2 AND last_digest_on = $3`, d.previous, d.userID, d.today)
+	if err != nil {
+		return fmt.Errorf("error resetting last digest: %v", err)
+	}
+	return tx.Commit()
+}
+
+// digestMessage lists the notifications oldest first, with times in the user's zone
+func digestMessage(userID int64, email string, pending []Notification, loc *time.Location, now time.Time) notifications.Message {
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+
+	title := "Your daily digest: 1 update"
+	if len(pending) > 1 {
+		title = fmt.Sprintf("Your daily digest: %d updates", len(pending))
+	}
+
+	var body strings.Builder
+	body.WriteString("Here's what happened since your last digest.\n")
+	for _, n := range pending {
+		fmt.Fprintf(&body, "\n%s (%s)\n%s\n", n.Title, n.CreatedAt.In(loc).Format("Jan 2, 15:04"), n.Body)
+	}
+
+	return notifications.Message{
+		UserID:    userID,
+		Email:     email,
+		Kind:      "digest",
+		Title:     title,
+		Body:      body.String(),
+		CreatedAt: now,
+	}
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuaanNguyen/backend/notifications"
+	"github.com/LuaanNguyen/backend/notifications/smtptest"
+)
+
+func digestNotifications() []Notification {
+	// Out of order on purpose, the digest lists them oldest first
+	return []Notification{
+		{ID: 12, Title: "Your extension for Tent was approved", Body: "Requested end date Mar 10, 18:00.",
+			CreatedAt: time.Date(2026, 3, 8, 3, 5, 0, 0, time.UTC)},
+		{ID: 9, Title: "Tent was requested", Body: "Someone wants to rent it.",
+			CreatedAt: time.Date(2026, 3, 7, 21, 40, 0, 0, time.UTC)},
+	}
+}
+
+func TestDigestMessage(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading time zone: %v", err)
+	}
+	now := time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC)
+
+	m := digestMessage(2, "owner@example.com", digestNotifications(), ny, now)
+
+	if m.UserID != 2 || m.Email != "owner@example.com" || m.Kind != "digest" || !m.CreatedAt.Equal(now) {
+		t.Errorf("digestMessage addressed %+v", m)
+	}
+	if m.Title != "Your daily digest: 2 updates" {
+		t.Errorf("title = %q", m.Title)
+	}
+
+	want := "Here's what happened since your last digest.\n" +
+		"\nTent was requested (Mar 7, 16:40)\nSomeone wants to rent it.\n" +
+		"\nYour extension for Tent was approved (Mar 7, 22:05)\nRequested end date Mar 10, 18:00.\n"
+	if m.Body != want {
+		t.Errorf("body = %q, want %q", m.Body, want)
+	}
+}
+
+func TestDigestMessageSingleUpdate(t *testing.T) {
+	pending := digestNotifications()[:1]
+	m := digestMessage(2, "owner@example.com", pending, time.UTC, time.Now())
+
+	if m.Title != "Your daily digest: 1 update" {
+		t.Errorf("title = %q", m.Title)
+	}
+	if !strings.Contains(m.Body, "(Mar 8, 03:05)") {
+		t.Errorf("body doesn't show the time in UTC: %q", m.Body)
+	}
+}
+
+func testDigest() digest {
+	return digest{
+		userID:  2,
+		email:   "owner@example.com",
+		pending: digestNotifications(),
+		loc:     time.UTC,
+		today:   "2026-03-08",
+	}
+}
+
+func newDigestChannel(t *testing.T, server *smtptest.Server) notifications.Channel {
+	t.Helper()
+	t.Setenv("SMTP_ADDR", server.Addr)
+	t.Setenv("SMTP_FROM", "noreply@example.com")
+	t.Setenv("SMTP_USERNAME", "")
+	channel, err := notifications.NewSMTPChannelFromEnv()
+	if err != nil {
+		t.Fatalf("NewSMTPChannelFromEnv: %v", err)
+	}
+	return channel
+}
+
+func TestDeliverDigest(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	channel := newDigestChannel(t, server)
+
+	if err := deliverDigest(channel, testDigest(), time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("deliverDigest: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(messages))
+	}
+	m := messages[0]
+	if len(m.To) != 1 || m.To[0] != "owner@example.com" {
+		t.Errorf("RCPT TO = %q, want [owner@example.com]", m.To)
+	}
+	for _, want := range []string{
+		"Subject: Your daily digest: 2 updates\n",
+		"Tent was requested (Mar 7, 21:40)\n",
+		"Your extension for Tent was approved (Mar 8, 03:05)\n",
+	} {
+		if !strings.Contains(m.Data, want) {
+			t.Errorf("digest email is missing %q:\n%s", want, m.Data)
+		}
+	}
+}
+
+// A failed send has to come back as an error, sendDigest then flags the notifications pending again
+func TestDeliverDigestFailure(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	server.RejectRecipients()
+	channel := newDigestChannel(t, server)
+
+	if err := deliverDigest(channel, testDigest(), time.Now()); err == nil {
+		t.Fatal("deliverDigest to a rejected recipient succeeded")
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("server got %d messages, want 0", n)
+	}
+}
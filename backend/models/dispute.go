@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Dispute statuses, matching the CHECK constraint on disputes.status
+const (
+	DisputeOpen      = "open"      // waiting for the other party
+	DisputeResponded = "responded" // both sides are in, waiting for a moderator
+	DisputeResolved  = "resolved"  // a moderator ruled
+)
+
+// Dispute reasons, matching the CHECK constraint on disputes.reason
+const (
+	ReasonNotAsDescribed = "not_as_described"
+	ReasonDamaged        = "damaged"
+	ReasonNoShow         = "no_show"
+	ReasonLateReturn     = "late_return"
+	ReasonOther          = "other"
+)
+
+// Rulings a moderator can make, matching the CHECK constraint on disputes.ruling
+const (
+	RulingRefund         = "refund"          // the renter gets the whole total_price back
+	RulingPartialCapture = "partial_capture" // the owner keeps Amount, the renter gets the rest back
+	RulingNoAction       = "no_action"       // the rental is settled as usual
+)
+
+// Dispute event kinds, matching the CHECK constraint on dispute_events.kind
+const (
+	DisputeEventOpened    = "opened"
+	DisputeEventEvidence  = "evidence"
+	DisputeEventResponded = "responded"
+	DisputeEventResolved  = "resolved"
+)
+
+// MaxDisputeEvidence caps how many photos one dispute can have, both parties together
+const MaxDisputeEvidence = 20
+
+type Dispute struct {
+	ID           int64             `json:"id"`
+	RentalID     int64             `json:"rental_id"`
+	ItemID       int64             `json:"item_id"`
+	OwnerID      int64             `json:"owner_id"`
+	RenterID     int64             `json:"renter_id"`
+	OpenedBy     int64             `json:"opened_by"`
+	Reason       string            `json:"reason"`
+	Description  string            `json:"description"`
+	Status       string            `json:"status"`
+	Response     *string           `json:"response,omitempty"`      // the other party's side, nullable
+	RespondedAt  *time.Time        `json:"responded_at,omitempty"`  // nullable
+	Ruling       *string           `json:"ruling,omitempty"`        // set once resolved
+	RefundAmount *int64            `json:"refund_amount,omitempty"` // what the ruling gave back to the renter
+	RulingNotes  *string           `json:"ruling_notes,omitempty"`  // nullable
+	ResolvedBy   *int64            `json:"resolved_by,omitempty"`   // the moderator, nullable
+	ResolvedAt   *time.Time        `json:"resolved_at,omitempty"`   // nullable
+	CreatedAt    time.Time         `json:"created_at"`
+	Evidence     []DisputeEvidence `json:"evidence"`
+	Events       []DisputeEvent    `json:"events"`
+}
+
+// Respondent is the party who didn't open the dispute
+func (d Dispute) Respondent() int64 {
+	if d.OpenedBy == d.OwnerID {
+		return d.RenterID
+	}
+	return d.OwnerID
+}
+
+type DisputeEvidence struct {
+	ID          int64     `json:"id"`
+	DisputeID   int64     `json:"dispute_id"`
+	UploadedBy  int64     `json:"uploaded_by"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	StorageKey  string    `json:"-"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DisputeEvent is one step of a dispute's history
+type DisputeEvent struct {
+	ID        int64     `json:"id"`
+	DisputeID int64     `json:"dispute_id"`
+	ActorID   int64     `json:"actor_id"`
+	Kind      string    `json:"kind"`
+	Note      *string   `json:"note,omitempty"` // nullable
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DisputeEvidenceURL is where a dispute's evidence photo is served
+func DisputeEvidenceURL(disputeID, evidenceID int64) string {
+	return fmt.Sprintf("/api/disputes/%d/evidence/%d", disputeID, evidenceID)
+}
+
+// Parse the request body of a new dispute
+type DisputeRequest struct {
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+}
+
+// Parse the other party's side of a dispute
+type DisputeResponseRequest struct {
+	Response string `json:"response"`
+}
+
+// Parse a moderator's ruling. Amount is what the owner keeps, only for partial_capture.
+type DisputeRulingRequest struct {
+	Ruling string `json:"ruling"`
+	Amount int64  `json:"amount"`
+	Notes  string `json:"notes"`
+}
@@ -0,0 +1,530 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidDispute is returned for a dispute without a description or with an unknown reason
+var ErrInvalidDispute = errors.New("invalid dispute")
+
+// ErrInvalidRuling is returned for an unknown ruling or a partial capture outside 0..total_price
+var ErrInvalidRuling = errors.New("invalid dispute ruling")
+
+// ErrDisputeExists is returned when the rental already has an undecided dispute
+var ErrDisputeExists = errors.New("rental already has an open dispute")
+
+// ErrDisputeClosed is returned when a dispute is no longer waiting on the requested step
+var ErrDisputeClosed = errors.New("dispute is closed")
+
+// ErrDisputePending is returned when an approved rental with an undecided dispute is cancelled
+var ErrDisputePending = errors.New("rental has an open dispute")
+
+// ErrTooMuchDisputeEvidence is returned when a dispute already has MaxDisputeEvidence photos
+var ErrTooMuchDisputeEvidence = errors.New("too many evidence photos for this dispute")
+
+const disputeSelect = `
+	SELECT
+		d.d_id,
+		d.rental_id,
+		r.item_id,
+		i.owner_id,
+		r.renter_id,
+		d.opened_by,
+		d.reason,
+		d.description,
+		d.status,
+		d.response,
+		d.responded_at,
+		d.ruling,
+		d.refund_amount,
+		d.ruling_notes,
+		d.resolved_by,
+		d.resolved_at,
+		d.created_at
+	FROM disputes d
+	JOIN rentals r ON d.rental_id = r.rental_id
+	JOIN items i ON r.item_id = i.i_id`
+
+func scanDispute(row rowScanner) (Dispute, error) {
+	var d Dispute
+	err := row.Scan(
+		&d.ID,
+		&d.RentalID,
+		&d.ItemID,
+		&d.OwnerID,
+		&d.RenterID,
+		&d.OpenedBy,
+		&d.Reason,
+		&d.Description,
+		&d.Status,
+		&d.Response,
+		&d.RespondedAt,
+		&d.Ruling,
+		&d.RefundAmount,
+		&d.RulingNotes,
+		&d.ResolvedBy,
+		&d.ResolvedAt,
+		&d.CreatedAt,
+	)
+	d.Evidence = []DisputeEvidence{}
+	d.Events = []DisputeEvent{}
+	return d, err
+}
+
+// ValidDisputeReason reports whether reason is one of the Reason* values
+func ValidDisputeReason(reason string) bool {
+	switch reason {
+	case ReasonNotAsDescribed, ReasonDamaged, ReasonNoShow, ReasonLateReturn, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// ValidDisputeStatus reports whether status is one of the Dispute* statuses
+func ValidDisputeStatus(status string) bool {
+	switch status {
+	case DisputeOpen, DisputeResponded, DisputeResolved:
+		return true
+	}
+	return false
+}
+
+// hasOpenDispute reports whether the rental has a dispute still waiting on a ruling
+func hasOpenDispute(tx *sql.Tx, rentalID int64) (bool, error) {
+	var open bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM disputes WHERE rental_id = $1 AND status <> $2)`,
+		rentalID, DisputeResolved).Scan(&open)
+	if err != nil {
+		return false, fmt.Errorf("error querying disputes: %v", err)
+	}
+	return open, nil
+}
+
+// recordDisputeEvent adds a step to the dispute's history
+func recordDisputeEvent(tx *sql.Tx, disputeID, actorID int64, kind, note string) error {
+	_, err := tx.Exec(`
+		INSERT INTO dispute_events (d_id, actor_id, kind, note)
+		VALUES ($1, $2, $3, NULLIF($4, ''))`, disputeID, actorID, kind, note)
+	if err != nil {
+		return fmt.Errorf("error recording dispute event: %v", err)
+	}
+	return nil
+}
+
+// lockDisputeRental loads a dispute and locks its rental, the rental row guards the payment
+func lockDisputeRental(tx *sql.Tx, disputeID int64) (Dispute, Rental, error) {
+	dispute, err := scanDispute(tx.QueryRow(disputeSelect+" WHERE d.d_id = $1", disputeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Dispute{}, Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return Dispute{}, Rental{}, fmt.Errorf("error querying dispute: %v", err)
+	}
+
+	rental, err := lockRental(tx, dispute.RentalID)
+	if err != nil {
+		return Dispute{}, Rental{}, err
+	}
+
+	// Re-read under the lock, another request may have moved it on meanwhile
+	dispute, err = scanDispute(tx.QueryRow(disputeSelect+" WHERE d.d_id = $1", disputeID))
+	if err != nil {
+		return Dispute{}, Rental{}, fmt.Errorf("error querying dispute: %v", err)
+	}
+	return dispute, rental, nil
+}
+
+// -------------- Either party opens a dispute on a rental --------------
+// Disputes are opened before the rental is settled, while it is approved or active. Completing
+// a rental with an open dispute holds the payment until a moderator rules.
+func OpenDispute(rentalID, userID int64, req DisputeRequest) (Dispute, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := lockRental(tx, rentalID)
+	if err != nil {
+		return Dispute{}, err
+	}
+	if rental.PartyOf(userID) == "" {
+		return Dispute{}, ErrForbidden
+	}
+	if rental.Status != RentalApproved && rental.Status != RentalActive {
+		return Dispute{}, ErrIllegalTransition
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if !ValidDisputeReason(req.Reason) || req.Description == "" {
+		return Dispute{}, ErrInvalidDispute
+	}
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO disputes (rental_id, opened_by, reason, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING d_id`, rentalID, userID, req.Reason, req.Description).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return Dispute{}, ErrDisputeExists
+		}
+		return Dispute{}, fmt.Errorf("error creating dispute: %v", err)
+	}
+	if err := recordDisputeEvent(tx, id, userID, DisputeEventOpened, req.Description); err != nil {
+		return Dispute{}, err
+	}
+
+	dispute, err := scanDispute(tx.QueryRow(disputeSelect+" WHERE d.d_id = $1", id))
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error querying dispute: %v", err)
+	}
+	err = notify(tx, Notification{
+		UserID:   dispute.Respondent(),
+		Kind:     NotifyDisputeOpened,
+		Title:    fmt.Sprintf("A dispute was opened on %s", rental.ItemName),
+		Body:     "Add your side of the story and any photos before a moderator rules on it.",
+		RentalID: &rental.ID,
+	})
+	if err != nil {
+		return Dispute{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Dispute{}, fmt.Errorf("error committing dispute: %v", err)
+	}
+	return GetDispute(id)
+}
+
+// -------------- The other party gives their side of a dispute --------------
+func RespondToDispute(disputeID, userID int64, req DisputeResponseRequest) (Dispute, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	dispute, rental, err := lockDisputeRental(tx, disputeID)
+	if err != nil {
+		return Dispute{}, err
+	}
+	if dispute.Respondent() != userID {
+		return Dispute{}, ErrForbidden
+	}
+	if dispute.Status != DisputeOpen {
+		return Dispute{}, ErrDisputeClosed
+	}
+	response := strings.TrimSpace(req.Response)
+	if response == "" {
+		return Dispute{}, ErrInvalidDispute
+	}
+
+	_, err = tx.Exec(`
+		UPDATE disputes
+		SET status = $1, response = $2, responded_at = CURRENT_TIMESTAMP
+		WHERE d_id = $3`, DisputeResponded, response, disputeID)
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error updating dispute: %v", err)
+	}
+	if err := recordDisputeEvent(tx, disputeID, userID, DisputeEventResponded, response); err != nil {
+		return Dispute{}, err
+	}
+	err = notify(tx, Notification{
+		UserID:   dispute.OpenedBy,
+		Kind:     NotifyDisputeResponded,
+		Title:    fmt.Sprintf("Your dispute on %s got a response", rental.ItemName),
+		Body:     "A moderator will rule on it next.",
+		RentalID: &rental.ID,
+	})
+	if err != nil {
+		return Dispute{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Dispute{}, fmt.Errorf("error committing dispute: %v", err)
+	}
+	return GetDispute(disputeID)
+}
+
+// -------------- Moderator rules on a dispute --------------
+// refund gives the renter the whole total back, partial_capture lets the owner keep req.Amount
+// and refunds the rest, both end the rental (approved ones as cancelled, the others as completed).
+// no_action leaves a running rental alone and settles a completed one as usual.
+func ResolveDispute(disputeID, moderatorID int64, req DisputeRulingRequest) (Dispute, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	dispute, rental, err := lockDisputeRental(tx, disputeID)
+	if err != nil {
+		return Dispute{}, err
+	}
+	// Nobody rules on their own rental
+	if moderatorID == rental.RenterID || moderatorID == rental.OwnerID {
+		return Dispute{}, ErrForbidden
+	}
+	// Open disputes can be ruled on too, for parties who never answer
+	if dispute.Status == DisputeResolved {
+		return Dispute{}, ErrDisputeClosed
+	}
+
+	var refund int64
+	switch req.Ruling {
+	case RulingRefund:
+		refund = rental.TotalPrice
+	case RulingPartialCapture:
+		if req.Amount < 0 || req.Amount > rental.TotalPrice {
+			return Dispute{}, ErrInvalidRuling
+		}
+		refund = rental.TotalPrice - req.Amount
+	case RulingNoAction:
+	default:
+		return Dispute{}, ErrInvalidRuling
+	}
+
+	// Resolve first, so settling a completed rental below no longer sees an open dispute
+	notes := strings.TrimSpace(req.Notes)
+	_, err = tx.Exec(`
+		UPDATE disputes
+		SET status = $1, ruling = $2, refund_amount = $3, ruling_notes = NULLIF($4, ''),
+			resolved_by = $5, resolved_at = CURRENT_TIMESTAMP
+		WHERE d_id = $6`, DisputeResolved, req.Ruling, refund, notes, moderatorID, disputeID)
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error updating dispute: %v", err)
+	}
+	if err := recordDisputeEvent(tx, disputeID, moderatorID, DisputeEventResolved, notes); err != nil {
+		return Dispute{}, err
+	}
+
+	previousStatus := rental.Status
+	if err := settleDispute(tx, &rental, moderatorID, req.Ruling, refund); err != nil {
+		return Dispute{}, err
+	}
+
+	for _, userID := range []int64{rental.OwnerID, rental.RenterID} {
+		err := notify(tx, Notification{
+			UserID:   userID,
+			Kind:     NotifyDisputeResolved,
+			Title:    fmt.Sprintf("The dispute on %s was resolved", rental.ItemName),
+			Body:     fmt.Sprintf("Ruling: %s, %s refunded to the renter.", strings.ReplaceAll(req.Ruling, "_", " "), formatCents(refund)),
+			RentalID: &rental.ID,
+		})
+		if err != nil {
+			return Dispute{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Dispute{}, fmt.Errorf("error committing dispute: %v", err)
+	}
+	settlePayments(rental.ID)
+	if rental.Status != previousStatus {
+		publishRentalStatus(rental)
+	}
+	return GetDispute(disputeID)
+}
+
+// settleDispute moves the rental's money for a ruling. Completed rentals had their payment held
+// by the dispute; running ones are ended by any ruling other than no_action. An active rental
+// ended that way owes its late fees like one that was checked in.
+func settleDispute(tx *sql.Tx, rental *Rental, moderatorID int64, ruling string, refund int64) error {
+	if rental.Status == RentalCompleted {
+		if ruling == RulingNoAction {
+			return capturePayment(tx, rental)
+		}
+		return settleWithRefund(tx, rental, refund)
+	}
+	if ruling == RulingNoAction || (rental.Status != RentalApproved && rental.Status != RentalActive) {
+		return nil
+	}
+
+	to := RentalCompleted
+	if rental.Status == RentalApproved {
+		to = RentalCancelled
+	}
+	if err := recordStatus(tx, rental, moderatorID, to); err != nil {
+		return err
+	}
+	if to == RentalCompleted {
+		if err := settleLateReturn(tx, rental); err != nil {
+			return err
+		}
+	}
+	// The deposit stays with a pending damage claim, which is decided on its own
+	pending, err := hasPendingClaim(tx, rental.ID)
+	if err != nil {
+		return err
+	}
+	if !pending {
+		if err := settleDeposit(tx, rental, 0); err != nil {
+			return err
+		}
+	}
+	return settleWithRefund(tx, rental, refund)
+}
+
+// -------------- Get a dispute with its evidence and history --------------
+func GetDispute(disputeID int64) (Dispute, error) {
+	dispute, err := scanDispute(db.DB.QueryRow(disputeSelect+" WHERE d.d_id = $1", disputeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Dispute{}, ErrNotFound
+	}
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error querying dispute: %v", err)
+	}
+
+	rows, err := db.DB.Query(disputeEvidenceSelect+" WHERE d_id = $1 ORDER BY de_id", disputeID)
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error querying dispute evidence: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ev, err := scanDisputeEvidence(rows)
+		if err != nil {
+			return Dispute{}, fmt.Errorf("error scanning dispute evidence: %v", err)
+		}
+		dispute.Evidence = append(dispute.Evidence, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return Dispute{}, fmt.Errorf("error scanning dispute evidence: %v", err)
+	}
+
+	events, err := db.DB.Query(`
+		SELECT dev_id, d_id, actor_id, kind, note, created_at
+		FROM dispute_events
+		WHERE d_id = $1
+		ORDER BY created_at, dev_id`, disputeID)
+	if err != nil {
+		return Dispute{}, fmt.Errorf("error querying dispute events: %v", err)
+	}
+	defer events.Close()
+
+	for events.Next() {
+		var e DisputeEvent
+		if err := events.Scan(&e.ID, &e.DisputeID, &e.ActorID, &e.Kind, &e.Note, &e.CreatedAt); err != nil {
+			return Dispute{}, fmt.Errorf("error scanning dispute event: %v", err)
+		}
+		dispute.Events = append(dispute.Events, e)
+	}
+	return dispute, events.Err()
+}
+
+// -------------- Get disputes, optionally for one rental or by status --------------
+func GetDisputes(rentalID int64, status string) ([]Dispute, error) {
+	query := disputeSelect + " WHERE TRUE"
+	var args []interface{}
+	if rentalID != 0 {
+		args = append(args, rentalID)
+		query += fmt.Sprintf(" AND d.rental_id = $%d", len(args))
+	}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND d.status = $%d", len(args))
+	}
+	query += " ORDER BY d.created_at"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying disputes: %v", err)
+	}
+	defer rows.Close()
+
+	disputes := []Dispute{}
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning dispute: %v", err)
+		}
+		disputes = append(disputes, d)
+	}
+	return disputes, rows.Err()
+}
+
+// -------------- Dispute evidence photos --------------
+
+const disputeEvidenceSelect = `
+	SELECT de_id, d_id, uploaded_by, content_type, size_bytes, storage_key, created_at
+	FROM dispute_evidence`
+
+func scanDisputeEvidence(row rowScanner) (DisputeEvidence, error) {
+	var ev DisputeEvidence
+	err := row.Scan(&ev.ID, &ev.DisputeID, &ev.UploadedBy, &ev.ContentType, &ev.Size, &ev.StorageKey, &ev.CreatedAt)
+	ev.URL = DisputeEvidenceURL(ev.DisputeID, ev.ID)
+	return ev, err
+}
+
+// AddDisputeEvidence records a batch of stored evidence photos, only until the dispute is
+// resolved. The batch is recorded whole or not at all, so a failed upload can be retried as is.
+func AddDisputeEvidence(evidence []DisputeEvidence) error {
+	if len(evidence) == 0 {
+		return nil
+	}
+	disputeID := evidence[0].DisputeID
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the dispute so concurrent uploads can't pass the cap together
+	var status string
+	var count int
+	err = tx.QueryRow(`
+		SELECT status, (SELECT COUNT(*) FROM dispute_evidence ev WHERE ev.d_id = d.d_id)
+		FROM disputes d
+		WHERE d.d_id = $1
+		FOR UPDATE`, disputeID).Scan(&status, &count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error locking dispute: %v", err)
+	}
+	if status == DisputeResolved {
+		return ErrDisputeClosed
+	}
+	if count+len(evidence) > MaxDisputeEvidence {
+		return ErrTooMuchDisputeEvidence
+	}
+
+	for i := range evidence {
+		ev := &evidence[i]
+		err = tx.QueryRow(`
+			INSERT INTO dispute_evidence (d_id, uploaded_by, content_type, size_bytes, storage_key)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING de_id, created_at`, disputeID, ev.UploadedBy, ev.ContentType, ev.Size, ev.StorageKey).
+			Scan(&ev.ID, &ev.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error creating dispute evidence: %v", err)
+		}
+		ev.DisputeID = disputeID
+		ev.URL = DisputeEvidenceURL(disputeID, ev.ID)
+
+		if err := recordDisputeEvent(tx, disputeID, ev.UploadedBy, DisputeEventEvidence, ""); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func GetDisputeEvidence(disputeID, evidenceID int64) (DisputeEvidence, error) {
+	ev, err := scanDisputeEvidence(db.DB.QueryRow(disputeEvidenceSelect+" WHERE d_id = $1 AND de_id = $2", disputeID, evidenceID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DisputeEvidence{}, ErrNotFound
+	}
+	if err != nil {
+		return DisputeEvidence{}, fmt.Errorf("error querying dispute evidence: %v", err)
+	}
+	return ev, nil
+}
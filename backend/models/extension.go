@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Extension statuses, matching the CHECK constraint on rental_extensions.status
+const (
+	ExtensionPending   = "pending"
+	ExtensionApproved  = "approved"
+	ExtensionRejected  = "rejected"
+	ExtensionCancelled = "cancelled" // withdrawn by the renter
+)
+
+// ErrExtensionPending is returned when a rental already has an extension waiting on the owner
+var ErrExtensionPending = errors.New("rental already has a pending extension")
+
+// ErrExtensionClosed is returned when deciding an extension that was already decided
+var ErrExtensionClosed = errors.New("extension already decided")
+
+// extensionDeciders lists who may move a pending extension to each status
+var extensionDeciders = map[string]string{
+	ExtensionApproved:  PartyOwner,
+	ExtensionRejected:  PartyOwner,
+	ExtensionCancelled: PartyRenter,
+}
+
+// RentalExtension is a renter's request to move a rental's end date later
+type RentalExtension struct {
+	ID              int64      `json:"id"`
+	RentalID        int64      `json:"rental_id"`
+	RequestedBy     int64      `json:"requested_by"`
+	PreviousEndDate time.Time  `json:"previous_end_date"`
+	NewEndDate      time.Time  `json:"new_end_date"`
+	ExtraPrice      int64      `json:"extra_price"`       // added to total_price on approval, fee included
+	ExtraServiceFee int64      `json:"extra_service_fee"` // part of ExtraPrice kept by the platform
+	Status          string     `json:"status"`
+	DecidedBy       *int64     `json:"decided_by,omitempty"` // nullable
+	DecidedAt       *time.Time `json:"decided_at,omitempty"` // nullable
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Parse the body of POST /rentals/{id}/extend
+type ExtensionRequest struct {
+	EndDate time.Time `json:"end_date"`
+}
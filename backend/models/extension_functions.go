@@ -0,0 +1,265 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/LuaanNguyen/backend/payments"
+	"github.com/lib/pq"
+)
+
+const extensionSelect = `
+	SELECT re_id, rental_id, requested_by, previous_end_date, new_end_date, extra_price,
+		extra_service_fee, status, decided_by, decided_at, created_at
+	FROM rental_extensions`
+
+func scanExtension(row rowScanner) (RentalExtension, error) {
+	var e RentalExtension
+	err := row.Scan(&e.ID, &e.RentalID, &e.RequestedBy, &e.PreviousEndDate, &e.NewEndDate, &e.ExtraPrice,
+		&e.ExtraServiceFee, &e.Status, &e.DecidedBy, &e.DecidedAt, &e.CreatedAt)
+	return e, err
+}
+
+// extensionReference identifies the payment that replaces a rental's authorization once an
+// extension is approved
+func extensionReference(rental Rental, extensionID int64) string {
+	return fmt.Sprintf("%s-extension-%d", rentalReference(rental), extensionID)
+}
+
+// canExtend reports whether the rental is running and not overdue yet, overdue rentals are
+// charged late fees instead
+func canExtend(rental Rental) bool {
+	return (rental.Status == RentalApproved || rental.Status == RentalActive) && rental.OverdueAt == nil
+}
+
+// lockRental loads a rental FOR UPDATE inside the caller's transaction
+func lockRental(tx *sql.Tx, rentalID int64) (Rental, error) {
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return Rental{}, fmt.Errorf("error querying rental: %v", err)
+	}
+	return rental, nil
+}
+
+// -------------- Renter asks to keep the item until a later end date --------------
+// The extra days are priced at the item's current daily price and have to fit around the
+// item's other bookings. Nothing is charged until the owner approves.
+func RequestExtension(rentalID, userID int64, newEnd time.Time) (RentalExtension, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return RentalExtension{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := lockRental(tx, rentalID)
+	if err != nil {
+		return RentalExtension{}, err
+	}
+	if rental.PartyOf(userID) != PartyRenter {
+		return RentalExtension{}, ErrForbidden
+	}
+	if !canExtend(rental) {
+		return RentalExtension{}, ErrIllegalTransition
+	}
+	if !newEnd.After(rental.EndDate) || !newEnd.After(time.Now()) {
+		return RentalExtension{}, ErrInvalidDates
+	}
+
+	if err := checkAvailability(tx, rental.ItemID, rental.EndDate, newEnd, rental.ID); err != nil {
+		return RentalExtension{}, err
+	}
+
+	var price int64
+	if err := tx.QueryRow("SELECT i_price FROM items WHERE i_id = $1", rental.ItemID).Scan(&price); err != nil {
+		return RentalExtension{}, fmt.Errorf("error querying item price: %v", err)
+	}
+	quote := CalculateQuote(rental.ItemID, price, rental.EndDate, newEnd)
+
+	ext, err := scanExtension(tx.QueryRow(`
+		INSERT INTO rental_extensions (rental_id, requested_by, previous_end_date, new_end_date, extra_price, extra_service_fee)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING re_id, rental_id, requested_by, previous_end_date, new_end_date, extra_price,
+			extra_service_fee, status, decided_by, decided_at, created_at`,
+		rental.ID, userID, rental.EndDate, newEnd, quote.Total, quote.ServiceFee))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return RentalExtension{}, ErrExtensionPending
+		}
+		return RentalExtension{}, fmt.Errorf("error creating extension: %v", err)
+	}
+
+	err = notify(tx, Notification{
+		UserID:   rental.OwnerID,
+		Kind:     NotifyExtensionRequested,
+		Title:    fmt.Sprintf("%s wants to keep %s longer", rental.RenterName, rental.ItemName),
+		Body:     fmt.Sprintf("New end date %s, for %s more.", newEnd.Format("Jan 2, 15:04"), formatCents(ext.ExtraPrice)),
+		RentalID: &rental.ID,
+	})
+	if err != nil {
+		return RentalExtension{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RentalExtension{}, fmt.Errorf("error committing extension: %v", err)
+	}
+	return ext, nil
+}
+
+// -------------- Approve, reject (owner) or withdraw (renter) a pending extension --------------
+// Approving re-checks availability, moves the rental's end date and charges the extra price.
+func DecideExtension(rentalID, extensionID, userID int64, to string) (RentalExtension, Rental, error) {
+	decider, ok := extensionDeciders[to]
+	if !ok {
+		return RentalExtension{}, Rental{}, fmt.Errorf("unknown extension status %q", to)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return RentalExtension{}, Rental{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := lockRental(tx, rentalID)
+	if err != nil {
+		return RentalExtension{}, Rental{}, err
+	}
+	ext, err := scanExtension(tx.QueryRow(extensionSelect+" WHERE re_id = $1 AND rental_id = $2 FOR UPDATE", extensionID, rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RentalExtension{}, Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return RentalExtension{}, Rental{}, fmt.Errorf("error querying extension: %v", err)
+	}
+
+	if rental.PartyOf(userID) != decider {
+		return RentalExtension{}, Rental{}, ErrForbidden
+	}
+	if ext.Status != ExtensionPending {
+		return RentalExtension{}, Rental{}, ErrExtensionClosed
+	}
+
+	// An approved paid extension swaps the rental's authorization for a bigger one. The old one is
+	// queued for release and only let go after the commit, until then the new one is what gets
+	// released on failure.
+	previous, previousTotal := rental.PaymentID, rental.TotalPrice
+	var paymentID *string
+	if to == ExtensionApproved {
+		// The rental may have been cancelled, completed or gone overdue since the request
+		if !canExtend(rental) || !rental.EndDate.Equal(ext.PreviousEndDate) {
+			return RentalExtension{}, Rental{}, ErrIllegalTransition
+		}
+		if err := checkAvailability(tx, rental.ItemID, rental.EndDate, ext.NewEndDate, rental.ID); err != nil {
+			return RentalExtension{}, Rental{}, err
+		}
+		if paymentID, err = applyExtension(tx, &rental, ext); err != nil {
+			return RentalExtension{}, Rental{}, err
+		}
+		if paymentID != nil {
+			step := fmt.Sprintf("extension-%d-previous-release", ext.ID)
+			if err := queueRelease(tx, rental, *previous, previousTotal, step); err != nil {
+				releasePayment(rental, paymentID, rental.TotalPrice, ext.ID)
+				return RentalExtension{}, Rental{}, err
+			}
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE rental_extensions SET status = $1, decided_by = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE re_id = $3
+		RETURNING status, decided_by, decided_at`, to, userID, ext.ID).
+		Scan(&ext.Status, &ext.DecidedBy, &ext.DecidedAt)
+	if err != nil {
+		releasePayment(rental, paymentID, rental.TotalPrice, ext.ID)
+		return RentalExtension{}, Rental{}, fmt.Errorf("error updating extension: %v", err)
+	}
+
+	if to != ExtensionCancelled {
+		err := notify(tx, Notification{
+			UserID:   rental.RenterID,
+			Kind:     NotifyExtensionDecided,
+			Title:    fmt.Sprintf("Your extension for %s was %s", rental.ItemName, to),
+			Body:     fmt.Sprintf("Requested end date %s.", ext.NewEndDate.Format("Jan 2, 15:04")),
+			RentalID: &rental.ID,
+		})
+		if err != nil {
+			releasePayment(rental, paymentID, rental.TotalPrice, ext.ID)
+			return RentalExtension{}, Rental{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		releasePayment(rental, paymentID, rental.TotalPrice, ext.ID)
+		return RentalExtension{}, Rental{}, fmt.Errorf("error committing extension: %v", err)
+	}
+	if paymentID != nil {
+		settlePayments(rental.ID)
+	}
+	return ext, rental, nil
+}
+
+// applyExtension moves the rental's end date and adds the extension's price. A paid rental gets
+// a new authorization for the new total, which replaces the old one so completing and cancelling
+// keep working on a single payment. Returns the new payment, if any; releasing the old one is
+// up to the caller.
+func applyExtension(tx *sql.Tx, rental *Rental, ext RentalExtension) (*string, error) {
+	total := rental.TotalPrice + ext.ExtraPrice
+
+	var paymentID *string
+	if rental.PaymentID != nil {
+		id, err := payments.Default.Authorize(rental.RenterID, total, extensionReference(*rental, ext.ID))
+		if err != nil {
+			return nil, paymentError("authorizing extension", err)
+		}
+		paymentID = &id
+		rental.PaymentID = paymentID
+	}
+
+	err := tx.QueryRow(`
+		UPDATE rentals SET end_date = $1, total_price = $2, service_fee = service_fee + $3, payment_id = $4
+		WHERE rental_id = $5
+		RETURNING end_date, total_price, service_fee`, ext.NewEndDate, total, ext.ExtraServiceFee, rental.PaymentID, rental.ID).
+		Scan(&rental.EndDate, &rental.TotalPrice, &rental.ServiceFee)
+	if err != nil {
+		releasePayment(*rental, paymentID, total, ext.ID)
+		return nil, fmt.Errorf("error extending rental: %v", err)
+	}
+
+	if err := postTransaction(tx, &rental.RenterID, TxCharge, *rental, ext.ExtraPrice, rental.PaymentID); err != nil {
+		releasePayment(*rental, paymentID, total, ext.ID)
+		return nil, err
+	}
+	return paymentID, nil
+}
+
+// releasePayment gives back the authorization of an extension that didn't go through
+func releasePayment(rental Rental, paymentID *string, amount int64, extensionID int64) {
+	if paymentID != nil {
+		releaseAuthorization(rental, *paymentID, amount, fmt.Sprintf("extension-%d-release", extensionID))
+	}
+}
+
+// -------------- Get a rental's extensions, newest first --------------
+func GetRentalExtensions(rentalID int64) ([]RentalExtension, error) {
+	rows, err := db.DB.Query(extensionSelect+" WHERE rental_id = $1 ORDER BY created_at DESC", rentalID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying extensions: %v", err)
+	}
+	defer rows.Close()
+
+	extensions := []RentalExtension{}
+	for rows.Next() {
+		e, err := scanExtension(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning extension: %v", err)
+		}
+		extensions = append(extensions, e)
+	}
+	return extensions, rows.Err()
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Handover kinds: checkout hands the item to the renter, checkin hands it back
+const (
+	HandoverCheckout = "checkout"
+	HandoverCheckin  = "checkin"
+)
+
+// MaxHandoverPhotos caps how many photos one handover report can have, both parties together
+const MaxHandoverPhotos = 20
+
+// HandoverReport records one handover. The rental changes status once both parties confirmed.
+type HandoverReport struct {
+	ID                int64           `json:"id"`
+	RentalID          int64           `json:"rental_id"`
+	Kind              string          `json:"kind"`
+	OwnerConfirmedAt  *time.Time      `json:"owner_confirmed_at,omitempty"`  // nullable
+	RenterConfirmedAt *time.Time      `json:"renter_confirmed_at,omitempty"` // nullable
+	OwnerNotes        *string         `json:"owner_notes,omitempty"`         // condition as the owner saw it
+	RenterNotes       *string         `json:"renter_notes,omitempty"`        // condition as the renter saw it
+	CompletedAt       *time.Time      `json:"completed_at,omitempty"`        // set when the second party confirms
+	CreatedAt         time.Time       `json:"created_at"`
+	Photos            []HandoverPhoto `json:"photos"`
+}
+
+type HandoverPhoto struct {
+	ID          int64     `json:"id"`
+	ReportID    int64     `json:"report_id"`
+	RentalID    int64     `json:"rental_id"`
+	UploadedBy  int64     `json:"uploaded_by"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	StorageKey  string    `json:"-"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// HandoverPhotoURL is where a handover photo is served
+func HandoverPhotoURL(rentalID, photoID int64) string {
+	return fmt.Sprintf("/api/rentals/%d/handovers/photos/%d", rentalID, photoID)
+}
+
+// Parse the JSON body of a checkout or checkin, multipart requests send notes as a form field
+type HandoverRequest struct {
+	Notes string `json:"notes"`
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// ErrAlreadyConfirmed is returned when a party confirms the same handover twice
+var ErrAlreadyConfirmed = errors.New("handover already confirmed")
+
+// ErrTooManyPhotos is returned when a handover report would pass MaxHandoverPhotos
+var ErrTooManyPhotos = errors.New("too many photos for this handover")
+
+// handoverSteps maps each handover kind to the rental status it starts from and moves to
+var handoverSteps = map[string]struct{ From, To string }{
+	HandoverCheckout: {From: RentalApproved, To: RentalActive},
+	HandoverCheckin:  {From: RentalActive, To: RentalCompleted},
+}
+
+const handoverSelect = `
+	SELECT hr_id, rental_id, kind, owner_confirmed_at, renter_confirmed_at,
+		owner_notes, renter_notes, completed_at, created_at
+	FROM handover_reports`
+
+func scanHandover(row rowScanner) (HandoverReport, error) {
+	var h HandoverReport
+	err := row.Scan(&h.ID, &h.RentalID, &h.Kind, &h.OwnerConfirmedAt, &h.RenterConfirmedAt,
+		&h.OwnerNotes, &h.RenterNotes, &h.CompletedAt, &h.CreatedAt)
+	h.Photos = []HandoverPhoto{}
+	return h, err
+}
+
+const handoverPhotoSelect = `
+	SELECT hp.hp_id, hp.hr_id, hr.rental_id, hp.uploaded_by, hp.content_type, hp.size_bytes, hp.storage_key, hp.created_at
+	FROM handover_photos hp
+	JOIN handover_reports hr ON hp.hr_id = hr.hr_id`
+
+func scanHandoverPhoto(row rowScanner) (HandoverPhoto, error) {
+	var p HandoverPhoto
+	err := row.Scan(&p.ID, &p.ReportID, &p.RentalID, &p.UploadedBy, &p.ContentType, &p.Size, &p.StorageKey, &p.CreatedAt)
+	p.URL = HandoverPhotoURL(p.RentalID, p.ID)
+	return p, err
+}
+
+// -------------- One party confirms a checkout or checkin --------------
+// The report is created by whichever party confirms first. When the second party
+// confirms, the rental moves on (approved -> active, or active -> completed) in the
+// same transaction. photos are already in storage; only their rows are written here.
+// An error means none of them was committed.
+func ConfirmHandover(rentalID, userID int64, kind, notes string, photos []HandoverPhoto) (HandoverReport, Rental, error) {
+	step, ok := handoverSteps[kind]
+	if !ok {
+		return HandoverReport{}, Rental{}, fmt.Errorf("unknown handover kind %q", kind)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return HandoverReport{}, Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error querying rental: %v", err)
+	}
+	party := rental.PartyOf(userID)
+	if party == "" {
+		return HandoverReport{}, Rental{}, ErrForbidden
+	}
+	if rental.Status != step.From {
+		return HandoverReport{}, Rental{}, ErrIllegalTransition
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO handover_reports (rental_id, kind)
+		VALUES ($1, $2)
+		ON CONFLICT (rental_id, kind) DO NOTHING`, rentalID, kind); err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error creating handover report: %v", err)
+	}
+	report, err := scanHandover(tx.QueryRow(handoverSelect+" WHERE rental_id = $1 AND kind = $2", rentalID, kind))
+	if err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error querying handover report: %v", err)
+	}
+
+	confirmedCol, notesCol := "owner_confirmed_at", "owner_notes"
+	confirmed, otherConfirmed := report.OwnerConfirmedAt != nil, report.RenterConfirmedAt != nil
+	if party == PartyRenter {
+		confirmedCol, notesCol = "renter_confirmed_at", "renter_notes"
+		confirmed, otherConfirmed = otherConfirmed, confirmed
+	}
+	if confirmed {
+		return HandoverReport{}, Rental{}, ErrAlreadyConfirmed
+	}
+
+	var photoCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM handover_photos WHERE hr_id = $1", report.ID).Scan(&photoCount); err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error counting handover photos: %v", err)
+	}
+	if photoCount+len(photos) > MaxHandoverPhotos {
+		return HandoverReport{}, Rental{}, ErrTooManyPhotos
+	}
+	for _, p := range photos {
+		if _, err := tx.Exec(`
+			INSERT INTO handover_photos (hr_id, uploaded_by, content_type, size_bytes, storage_key)
+			VALUES ($1, $2, $3, $4, $5)`, report.ID, userID, p.ContentType, p.Size, p.StorageKey); err != nil {
+			return HandoverReport{}, Rental{}, fmt.Errorf("error creating handover photo: %v", err)
+		}
+	}
+
+	// Column names come from the constants above, never from the request
+	_, err = tx.Exec(fmt.Sprintf(`
+		UPDATE handover_reports
+		SET %s = CURRENT_TIMESTAMP, %s = NULLIF($1, ''),
+			completed_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP END
+		WHERE hr_id = $3`, confirmedCol, notesCol), strings.TrimSpace(notes), otherConfirmed, report.ID)
+	if err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error confirming handover: %v", err)
+	}
+
+	if otherConfirmed {
+		if err := transitionLocked(tx, &rental, userID, party, step.To); err != nil {
+			return HandoverReport{}, Rental{}, err
+		}
+	}
+
+	// Read the report back before committing, so nothing can fail once the photos are on record
+	report, err = scanHandover(tx.QueryRow(handoverSelect+" WHERE hr_id = $1", report.ID))
+	if err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error querying handover report: %v", err)
+	}
+	if report.Photos, err = handoverPhotos(tx, report.ID); err != nil {
+		return HandoverReport{}, Rental{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return HandoverReport{}, Rental{}, fmt.Errorf("error committing handover: %v", err)
+	}
+	if otherConfirmed {
+		settlePayments(rental.ID)
+		publishRentalStatus(rental)
+	}
+	return report, rental, nil
+}
+
+func handoverPhotos(tx *sql.Tx, reportID int64) ([]HandoverPhoto, error) {
+	rows, err := tx.Query(handoverPhotoSelect+" WHERE hp.hr_id = $1 ORDER BY hp.hp_id", reportID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying handover photos: %v", err)
+	}
+	defer rows.Close()
+
+	photos := []HandoverPhoto{}
+	for rows.Next() {
+		p, err := scanHandoverPhoto(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning handover photo: %v", err)
+		}
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// -------------- Get a rental's handover reports with their photos --------------
+func GetHandoverReports(rentalID int64) ([]HandoverReport, error) {
+	rows, err := db.DB.Query(handoverSelect+" WHERE rental_id = $1 ORDER BY created_at", rentalID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying handover reports: %v", err)
+	}
+	defer rows.Close()
+
+	reports := []HandoverReport{}
+	byID := map[int64]int{}
+	for rows.Next() {
+		h, err := scanHandover(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning handover report: %v", err)
+		}
+		byID[h.ID] = len(reports)
+		reports = append(reports, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning handover reports: %v", err)
+	}
+
+	photos, err := db.DB.Query(handoverPhotoSelect+" WHERE hr.rental_id = $1 ORDER BY hp.hp_id", rentalID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying handover photos: %v", err)
+	}
+	defer photos.Close()
+
+	for photos.Next() {
+		p, err := scanHandoverPhoto(photos)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning handover photo: %v", err)
+		}
+		i := byID[p.ReportID]
+		reports[i].Photos = append(reports[i].Photos, p)
+	}
+	return reports, photos.Err()
+}
+
+func GetHandoverPhoto(rentalID, photoID int64) (HandoverPhoto, error) {
+	p, err := scanHandoverPhoto(db.DB.QueryRow(handoverPhotoSelect+" WHERE hr.rental_id = $1 AND hp.hp_id = $2", rentalID, photoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return HandoverPhoto{}, ErrNotFound
+	}
+	if err != nil {
+		return HandoverPhoto{}, fmt.Errorf("error querying handover photo: %v", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/lib/pq"
+)
+
+// ErrTooManyImages is returned when an item already has MaxImagesPerItem photos
+var ErrTooManyImages = errors.New("too many images for this item")
+
+// ErrInvalidOrder is returned when a reorder isn't a permutation of the item's positions
+var ErrInvalidOrder = errors.New("invalid image order")
+
+const itemImageSelect = `
+	SELECT img_id, i_id, position, content_type, size_bytes, etag, storage_key, thumb_key, created_at
+	FROM item_images`
+
+func scanItemImage(row rowScanner) (ItemImage, error) {
+	var img ItemImage
+	err := row.Scan(&img.ID, &img.ItemID, &img.Position, &img.ContentType, &img.Size,
+		&img.ETag, &img.StorageKey, &img.ThumbKey, &img.CreatedAt)
+	if err == nil {
+		img.setURLs()
+	}
+	return img, err
+}
+
+// -------------- Append a photo to the end of an item's gallery --------------
+// Someone else's item is reported as not found.
+func AddItemImage(img *ItemImage, ownerID int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the item so concurrent uploads get distinct positions
+	var count int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM item_images WHERE i_id = i.i_id)
+		FROM items i
+		WHERE i.i_id = $1 AND i.owner_id = $2
+		FOR UPDATE`, img.ItemID, ownerID).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error locking item: %v", err)
+	}
+	if count >= MaxImagesPerItem {
+		return ErrTooManyImages
+	}
+
+	img.Position = count + 1
+	err = tx.QueryRow(`
+		INSERT INTO item_images (i_id, position, content_type, size_bytes, etag, storage_key, thumb_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING img_id, created_at`,
+		img.ItemID, img.Position, img.ContentType, img.Size, img.ETag, img.StorageKey, img.ThumbKey).
+		Scan(&img.ID, &img.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating item image: %v", err)
+	}
+	img.setURLs()
+
+	return tx.Commit()
+}
+
+// -------------- Get all photos of an item in display order --------------
+func GetItemImages(itemID int64) ([]ItemImage, error) {
+	rows, err := db.DB.Query(itemImageSelect+" WHERE i_id = $1 ORDER BY position", itemID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying item images: %v", err)
+	}
+	defer rows.Close()
+
+	images := []ItemImage{}
+	for rows.Next() {
+		img, err := scanItemImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning item image: %v", err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// -------------- Get the photo at a position (1-based) --------------
+func GetItemImage(itemID int64, position int) (ItemImage, error) {
+	img, err := scanItemImage(db.DB.QueryRow(itemImageSelect+" WHERE i_id = $1 AND position = $2", itemID, position))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ItemImage{}, ErrNotFound
+	}
+	if err != nil {
+		return ItemImage{}, fmt.Errorf("error querying item image: %v", err)
+	}
+	return img, nil
+}
+
+// -------------- Delete a photo and close the gap in positions --------------
+// Returns the deleted row so the caller can remove the stored bytes.
+func DeleteItemImage(itemID int64, position int, ownerID int64) (ItemImage, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return ItemImage{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	img, err := scanItemImage(tx.QueryRow(`
+		DELETE FROM item_images
+		WHERE i_id = $1 AND position = $2
+		AND i_id IN (SELECT i_id FROM items WHERE owner_id = $3)
+		RETURNING img_id, i_id, position, content_type, size_bytes, etag, storage_key, thumb_key, created_at`,
+		itemID, position, ownerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ItemImage{}, ErrNotFound
+	}
+	if err != nil {
+		return ItemImage{}, fmt.Errorf("error deleting item image: %v", err)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE item_images SET position = position - 1
+		WHERE i_id = $1 AND position > $2`, itemID, position); err != nil {
+		return ItemImage{}, fmt.Errorf("error shifting item images: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ItemImage{}, fmt.Errorf("error committing item image: %v", err)
+	}
+	return img, nil
+}
+
+// -------------- Reorder an item's photos --------------
+// order lists the current positions in their new order, e.g. [3, 1, 2]
+// moves the third photo to the front.
+func ReorderItemImages(itemID int64, order []int, ownerID int64) ([]ItemImage, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM item_images WHERE i_id = i.i_id)
+		FROM items i
+		WHERE i.i_id = $1 AND i.owner_id = $2
+		FOR UPDATE`, itemID, ownerID).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error locking item: %v", err)
+	}
+
+	// Must be a permutation of 1..count
+	if len(order) != count {
+		return nil, ErrInvalidOrder
+	}
+	seen := make(map[int]bool, count)
+	for _, p := range order {
+		if p < 1 || p > count || seen[p] {
+			return nil, ErrInvalidOrder
+		}
+		seen[p] = true
+	}
+
+	oldPositions := make([]int64, len(order))
+	for i, p := range order {
+		oldPositions[i] = int64(p)
+	}
+	if _, err := tx.Exec(`
+		UPDATE item_images AS im
+		SET position = o.new_position
+		FROM unnest($2::int[]) WITH ORDINALITY AS o(old_position, new_position)
+		WHERE im.i_id = $1 AND im.position = o.old_position`, itemID, pq.Array(oldPositions)); err != nil {
+		return nil, fmt.Errorf("error reordering item images: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing item images: %v", err)
+	}
+	return GetItemImages(itemID)
+}
@@ -6,13 +6,18 @@ type Item struct {
     ID          int64      `json:"id" db:"i_id"`
     Name        string     `json:"name" db:"i_name"`
     Description string     `json:"description" db:"i_description"`
-    Image       *[]byte    `json:"image,omitempty" db:"i_image"` // nullable
     CategoryID  int64      `json:"category_id" db:"c_id"`
     OwnerID     int64      `json:"owner_id" db:"owner_id"`
     Price       int        `json:"price" db:"i_price"`
     DateListed  time.Time  `json:"date_listed" db:"i_date_listed"`
     Quantity    int        `json:"quantity" db:"i_quantity"`
     Available   bool       `json:"available" db:"i_available"`
+    Deposit     int        `json:"deposit" db:"i_deposit"` // refundable security deposit in cents, 0 for none
+    CancellationPolicy string `json:"cancellation_policy" db:"i_cancellation_policy"` // flexible, moderate or strict
+    LateFee     *int       `json:"late_fee,omitempty" db:"i_late_fee"` // per day late, nil charges the daily price
+    ImageURL    *string    `json:"image_url,omitempty"` // cover photo, nil if the item has none
+    Rating      float64    `json:"rating"`       // average published star rating, 0 without reviews
+    ReviewCount int        `json:"review_count"`
 }
 
 
@@ -20,8 +25,10 @@ type Item struct {
 type ItemData struct {
     Name        string  `json:"name"`
     Description string  `json:"description"`
-    Image       *[]byte `json:"image,omitempty"`
     Price       int     `json:"price"`
     Quantity    int     `json:"quantity"`
     Available   bool    `json:"available"`
+    Deposit     *int    `json:"deposit"` // nil keeps the current deposit
+    CancellationPolicy *string `json:"cancellation_policy"` // nil keeps the current policy
+    LateFee     *int    `json:"late_fee"` // nil keeps the current late fee
 }
\ No newline at end of file
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxImagesPerItem caps how many photos one listing can have
+const MaxImagesPerItem = 10
+
+type ItemImage struct {
+	ID           int64     `json:"id"`
+	ItemID       int64     `json:"item_id"`
+	Position     int       `json:"position"`
+	ContentType  string    `json:"content_type"`
+	Size         int       `json:"size"`
+	ETag         string    `json:"-"`
+	StorageKey   string    `json:"-"`
+	ThumbKey     string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Parse the request body of a reorder: current positions listed in their new order
+type ImageOrderRequest struct {
+	Order []int `json:"order"`
+}
+
+// ImageURL is where the n-th photo of an item is served
+func ImageURL(itemID int64, position int) string {
+	return fmt.Sprintf("/api/items/%d/images/%d", itemID, position)
+}
+
+// coverURL is the first photo of an item, or nil if it has none
+func coverURL(itemID int64, hasImage bool) *string {
+	if !hasImage {
+		return nil
+	}
+	url := ImageURL(itemID, 1)
+	return &url
+}
+
+func (img *ItemImage) setURLs() {
+	img.URL = ImageURL(img.ItemID, img.Position)
+	img.ThumbnailURL = img.URL + "?size=thumb"
+}
@@ -8,4 +8,10 @@ type ItemWithOwner struct {
     OwnerID     int64   `json:"owner_id"`
     OwnerName   string  `json:"owner_name"`
     Available   bool    `json:"available"`
+    Deposit     int     `json:"deposit"`
+    ImageURL    *string `json:"image_url,omitempty"` // cover photo, nil if the item has none
+    Rating           float64 `json:"rating"`       // average published star rating, 0 without reviews
+    ReviewCount      int     `json:"review_count"`
+    OwnerRating      float64 `json:"owner_rating"` // renters' average rating of the owner
+    OwnerReviewCount int     `json:"owner_review_count"`
 }
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// LateGracePeriod is how long after end_date a return still counts as on time
+const LateGracePeriod = time.Hour
+
+// lateDays counts the started days a return at now is past end, 0 within the grace period
+func lateDays(end, now time.Time) int {
+	if !now.After(end.Add(LateGracePeriod)) {
+		return 0
+	}
+	return int(math.Ceil(now.Sub(end).Hours() / 24))
+}
+
+// accrueLateFees charges the renter one late fee for every started day past end_date not charged
+// yet. It reports whether this flagged the rental overdue for the first time.
+func accrueLateFees(tx *sql.Tx, rental *Rental, now time.Time) (bool, error) {
+	days := lateDays(rental.EndDate, now)
+	if days <= rental.LateDays {
+		return false, nil
+	}
+
+	first := rental.OverdueAt == nil
+	newDays := days - rental.LateDays
+	err := tx.QueryRow(`
+		UPDATE rentals SET overdue_at = COALESCE(overdue_at, $1), late_days = $2
+		WHERE rental_id = $3
+		RETURNING overdue_at, late_days`, now, days, rental.ID).Scan(&rental.OverdueAt, &rental.LateDays)
+	if err != nil {
+		return false, fmt.Errorf("error updating late days: %v", err)
+	}
+
+	if err := postTransaction(tx, &rental.RenterID, TxLateFee, *rental, int64(newDays)*rental.LateFeePerDay, nil); err != nil {
+		return false, err
+	}
+	return first, nil
+}
+
+// settleLateReturn charges the late days the background job hasn't caught up with yet and
+// collects all the late fees, for an active rental that ends now
+func settleLateReturn(tx *sql.Tx, rental *Rental) error {
+	if _, err := accrueLateFees(tx, rental, time.Now()); err != nil {
+		return err
+	}
+	return collectLateFees(tx, rental)
+}
+
+// collectLateFees queues charging the accrued late fees now that the item is back, and paying
+// them to the owner once they came in. The fees are booked as owed already, so a declined card
+// doesn't hold up the checkin; the charge is retried like any other payment operation.
+func collectLateFees(tx *sql.Tx, rental *Rental) error {
+	amount := int64(rental.LateDays) * rental.LateFeePerDay
+	if amount <= 0 {
+		return nil
+	}
+
+	err := queuePayment(tx, *rental, "late", paymentOp{kind: opCharge, accountID: &rental.RenterID, amount: amount})
+	if err != nil {
+		return err
+	}
+	return postPayout(tx, *rental, amount, "late-payout")
+}
+
+// -------------- Flag late returns and accrue late fees, run by the background job --------------
+// Returns how many rentals were updated, and the errors of the ones that failed. Each rental
+// is handled in its own transaction and skipped if someone else holds it, so a checkin in
+// progress wins and several servers can run the job at once.
+func ProcessLateReturns(now time.Time) (int, error) {
+	rows, err := db.DB.Query(`
+		SELECT rental_id FROM rentals
+		WHERE status = $1 AND end_date < $2`, RentalActive, now.Add(-LateGracePeriod))
+	if err != nil {
+		return 0, fmt.Errorf("error querying late rentals: %v", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning late rental: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error scanning late rentals: %v", err)
+	}
+
+	// One broken rental mustn't keep the others from being flagged
+	updated := 0
+	var errs []error
+	for _, id := range ids {
+		ok, err := processLateReturn(id, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rental %d: %v", id, err))
+			continue
+		}
+		if ok {
+			updated++
+		}
+	}
+	return updated, errors.Join(errs...)
+}
+
+func processLateReturn(rentalID int64, now time.Time) (bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r SKIP LOCKED", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error locking rental: %v", err)
+	}
+	// Checked in since the scan
+	if rental.Status != RentalActive {
+		return false, nil
+	}
+
+	before := rental.LateDays
+	first, err := accrueLateFees(tx, &rental, now)
+	if err != nil {
+		return false, err
+	}
+	if rental.LateDays == before {
+		return false, nil
+	}
+
+	if first {
+		for _, userID := range []int64{rental.RenterID, rental.OwnerID} {
+			err := notify(tx, Notification{
+				UserID: userID,
+				Kind:   NotifyRentalOverdue,
+				Title:  fmt.Sprintf("%s is overdue", rental.ItemName),
+				Body: fmt.Sprintf("The rental ended %s and the return hasn't been checked in. A late fee of %s accrues for every started day.",
+					rental.EndDate.Format("Jan 2, 15:04"), formatCents(rental.LateFeePerDay)),
+				RentalID: &rental.ID,
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing late fees: %v", err)
+	}
+	return true, nil
+}
+
+// formatCents renders an amount in cents as dollars, e.g. 1650 as $16.50
+func formatCents(cents int64) string {
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+}
+
+// -------------- Get overdue rentals for items the user owns --------------
+func GetOverdueRentals(ownerID int64) ([]Rental, error) {
+	rows, err := db.DB.Query(rentalSelect+`
+		WHERE i.owner_id = $1 AND r.status = $2 AND r.overdue_at IS NOT NULL
+		ORDER BY r.end_date`, ownerID, RentalActive)
+	if err != nil {
+		return nil, fmt.Errorf("error querying overdue rentals: %v", err)
+	}
+	defer rows.Close()
+
+	rentals := []Rental{}
+	for rows.Next() {
+		r, err := scanRental(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rental: %v", err)
+		}
+		rentals = append(rentals, r)
+	}
+	return rentals, rows.Err()
+}
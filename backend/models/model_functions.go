@@ -1,16 +1,31 @@
 package models
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/LuaanNguyen/backend/db"
+	"github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when registering with an email that already has an account
+var ErrEmailTaken = errors.New("email already registered")
+
+// ErrNotFound is returned when the row being read or changed doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrForbidden is returned when the current user may not change the row
+var ErrForbidden = errors.New("forbidden")
+
+// ErrCategoryInUse is returned when deleting a category that items still reference
+var ErrCategoryInUse = errors.New("category still has items")
+
 // -------------- GetAllUsers retrieves all users from the database --------------
 func GetAllUsers() ([]User, error) {
-	rows, err := db.DB.Query("SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name FROM users")
+	rows, err := db.DB.Query("SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_role FROM users")
 	if err != nil {
 		return nil, fmt.Errorf("error querying users: %v", err)
 	}
@@ -19,7 +34,7 @@ func GetAllUsers() ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var u User
-		err := rows.Scan(&u.ID, &u.Email, &u.PhoneNumber, &u.FirstName, &u.LastName, &u.NickName)
+		err := rows.Scan(&u.ID, &u.Email, &u.PhoneNumber, &u.FirstName, &u.LastName, &u.NickName, &u.Role)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning user: %v", err)
 		}
@@ -32,8 +47,8 @@ func GetAllUsers() ([]User, error) {
 // -------------- GetUser retrieves a single user by ID --------------
 func GetUser(id int64) (User, error) {
 	var u User
-	err := db.DB.QueryRow("SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name FROM users WHERE u_id = $1", id).
-		Scan(&u.ID, &u.Email, &u.PhoneNumber, &u.FirstName, &u.LastName, &u.NickName)
+	err := db.DB.QueryRow("SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_role FROM users WHERE u_id = $1", id).
+		Scan(&u.ID, &u.Email, &u.PhoneNumber, &u.FirstName, &u.LastName, &u.NickName, &u.Role)
 	if err != nil {
 		return User{}, fmt.Errorf("error querying user: %v", err)
 	}
@@ -42,7 +57,12 @@ func GetUser(id int64) (User, error) {
 
 // -------------- GetAllItems retrieves all items from the database --------------
 func GetAllItems() ([]Item, error) {
-	rows, err := db.DB.Query("SELECT i_id, i_name, i_description, i_image, c_id, i_price, i_date_listed, i_quantity, i_available FROM items")
+	rows, err := db.DB.Query(`
+		SELECT i.i_id, i.i_name, i.i_description, i.c_id, i.owner_id, i.i_price, i.i_date_listed, i.i_quantity, i.i_available, i.i_deposit, i.i_cancellation_policy, i.i_late_fee,
+			EXISTS (SELECT 1 FROM item_images im WHERE im.i_id = i.i_id),
+			COALESCE(irs.rating, 0), COALESCE(irs.review_count, 0)
+		FROM items i
+		LEFT JOIN item_rating_stats irs ON irs.i_id = i.i_id`)
 	if err != nil {
 		return nil, fmt.Errorf("error querying items: %v", err)
 	}
@@ -51,10 +71,12 @@ func GetAllItems() ([]Item, error) {
 	var items []Item
 	for rows.Next() {
 		var i Item
-		err := rows.Scan(&i.ID, &i.Name, &i.Description, &i.Image, &i.CategoryID, &i.Price, &i.DateListed, &i.Quantity, &i.Available)
+		var hasImage bool
+		err := rows.Scan(&i.ID, &i.Name, &i.Description, &i.CategoryID, &i.OwnerID, &i.Price, &i.DateListed, &i.Quantity, &i.Available, &i.Deposit, &i.CancellationPolicy, &i.LateFee, &hasImage, &i.Rating, &i.ReviewCount)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning item: %v", err)
 		}
+		i.ImageURL = coverURL(i.ID, hasImage)
 		items = append(items, i)
 	}
 
@@ -65,10 +87,13 @@ func GetAllItems() ([]Item, error) {
 func GetUserByEmail(email string) (User, error) {
 	var user User 
 	err := db.DB.QueryRow(`
-		SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_password 
+		SELECT u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_role, u_password 
         FROM users 
-        WHERE u_email = $1`, email).
-		Scan(&user.ID, &user.Email, &user.PhoneNumber, &user.FirstName, &user.LastName, &user.NickName, &user.Password)
+        WHERE LOWER(u_email) = LOWER($1)`, email).
+		Scan(&user.ID, &user.Email, &user.PhoneNumber, &user.FirstName, &user.LastName, &user.NickName, &user.Role, &user.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
 	if err != nil {
 		return User{}, fmt.Errorf("error querying user: %v", err)
 	}
@@ -76,9 +101,61 @@ func GetUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
+// -------------- UpdateUserPassword replaces a user's stored password hash --------------
+func UpdateUserPassword(id int64, hashedPassword string) error {
+	_, err := db.DB.Exec("UPDATE users SET u_password = $1 WHERE u_id = $2", hashedPassword, id)
+	if err != nil {
+		return fmt.Errorf("error updating password: %v", err)
+	}
+	return nil
+}
+
+// -------------- UpdateUserRole changes a user's role --------------
+func UpdateUserRole(id int64, role string) (User, error) {
+	var u User
+	err := db.DB.QueryRow(`
+		UPDATE users SET u_role = $1
+		WHERE u_id = $2
+		RETURNING u_id, u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_role`, role, id).
+		Scan(&u.ID, &u.Email, &u.PhoneNumber, &u.FirstName, &u.LastName, &u.NickName, &u.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("error updating user role: %v", err)
+	}
+	return u, nil
+}
+
+// -------------- CreateUser inserts a new user, the ID is allocated by Postgres --------------
+func CreateUser(user *User) error {
+	query := `
+		INSERT INTO users (u_email, u_phone_number, u_first_name, u_last_name, u_nick_name, u_password)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING u_id, u_role`
+
+	err := db.DB.QueryRow(
+		query,
+		user.Email,
+		user.PhoneNumber,
+		user.FirstName,
+		user.LastName,
+		user.NickName,
+		user.Password,
+	).Scan(&user.ID, &user.Role)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("error creating user: %v", err)
+	}
+
+	return nil
+}
 
 // -------------- Get all rental items that are available for rent (Limit to 50 for now) --------------
-func GetAvailableItemsWithOwners() ([]ItemWithOwner, error) {
+func GetAvailableItemsWithOwners(opts ListOptions) ([]ItemWithOwner, error) {
     query := `
         SELECT 
             i.i_id, 
@@ -87,19 +164,32 @@ func GetAvailableItemsWithOwners() ([]ItemWithOwner, error) {
             i.i_price,
             i.owner_id,
             CONCAT(u.u_first_name, ' ', u.u_last_name) as owner_name,
-            i.i_available
+            i.i_available,
+            i.i_deposit,
+            EXISTS (SELECT 1 FROM item_images im WHERE im.i_id = i.i_id) AS has_image,
+            COALESCE(irs.rating, 0),
+            COALESCE(irs.review_count, 0),
+            COALESCE(ors.rating, 0),
+            COALESCE(ors.review_count, 0)
         FROM items i
         JOIN users u ON i.owner_id = u.u_id
+        LEFT JOIN item_rating_stats irs ON irs.i_id = i.i_id
+        LEFT JOIN owner_rating_stats ors ON ors.owner_id = i.owner_id
         WHERE i.i_available = true
-        AND NOT EXISTS (
-            SELECT 1 FROM rentals r
-            WHERE r.i_id = i.i_id 
-            AND r.status = 'approved'
-            AND r.end_date > CURRENT_TIMESTAMP
-        ) 
-		LIMIT 50`
-
-    rows, err := db.DB.Query(query)
+        AND (
+            SELECT COUNT(*) FROM rentals r
+            WHERE r.item_id = i.i_id 
+            AND (
+                r.status = 'active' -- checked out, even when it runs late
+                OR (r.status = 'approved' AND r.start_date <= CURRENT_TIMESTAMP AND r.end_date > CURRENT_TIMESTAMP)
+            )
+        ) < i.i_quantity`
+
+    var args []interface{}
+    ratingFilter, args := opts.ratingClause(args)
+    query += ratingFilter + opts.orderClause() + " LIMIT 50"
+
+    rows, err := db.DB.Query(query, args...)
     if err != nil {
         return nil, fmt.Errorf("error querying available items: %v", err)
     }
@@ -108,6 +198,7 @@ func GetAvailableItemsWithOwners() ([]ItemWithOwner, error) {
     var items []ItemWithOwner
     for rows.Next() {
         var item ItemWithOwner
+        var hasImage bool
         err := rows.Scan(
             &item.ID, 
             &item.Name, 
@@ -116,33 +207,103 @@ func GetAvailableItemsWithOwners() ([]ItemWithOwner, error) {
             &item.OwnerID, 
             &item.OwnerName, 
             &item.Available,
+            &item.Deposit,
+            &hasImage,
+            &item.Rating,
+            &item.ReviewCount,
+            &item.OwnerRating,
+            &item.OwnerReviewCount,
         )
         if err != nil {
             return nil, fmt.Errorf("error scanning item: %v", err)
         }
+        item.ImageURL = coverURL(item.ID, hasImage)
         items = append(items, item)
     }
     return items, nil
 }
 
 // -------------- Create a rental request --------------
+// The item row is locked while checking for overlaps so two renters can't
+// both grab the last unit for the same dates.
 func CreateRentalRequest(rental *RentalRequest) error {
+    // A day of slack on the start date, the frontend sends midnight in the renter's time zone
+    if !rental.StartDate.Before(rental.EndDate) || rental.StartDate.Before(time.Now().Add(-24*time.Hour)) {
+        return ErrInvalidDates
+    }
+
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return fmt.Errorf("error starting transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    var ownerID, price, deposit, lateFee int64
+    var available bool
+    var policy, itemName string
+    err = tx.QueryRow(`
+        SELECT owner_id, i_name, i_price, i_available, i_deposit, i_cancellation_policy, COALESCE(i_late_fee, i_price)
+        FROM items WHERE i_id = $1`, rental.ItemID).
+        Scan(&ownerID, &itemName, &price, &available, &deposit, &policy, &lateFee)
+    if errors.Is(err, sql.ErrNoRows) {
+        return ErrNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("error querying item: %v", err)
+    }
+    if ownerID == rental.RenterID {
+        return ErrForbidden
+    }
+    if !available {
+        return ErrItemUnavailable
+    }
+
+    if err := checkAvailability(tx, rental.ItemID, rental.StartDate, rental.EndDate, 0); err != nil {
+        return err
+    }
+
+    // Never trust a client supplied price
+    quote := CalculateQuote(rental.ItemID, price, rental.StartDate, rental.EndDate)
+    rental.TotalPrice = quote.Total
+
     query := `
-        INSERT INTO rentals (item_id, renter_id, start_date, end_date, status, total_price)
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING rental_id`
+        INSERT INTO rentals (item_id, renter_id, start_date, end_date, status, total_price, service_fee, deposit, cancellation_policy, late_fee_per_day)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        RETURNING rental_id, status`
     
-    err := db.DB.QueryRow(
+    err = tx.QueryRow(
         query,
         rental.ItemID,
         rental.RenterID,
         rental.StartDate,
         rental.EndDate,
-        "pending",
+        RentalPending,
         rental.TotalPrice,
-    ).Scan(&rental.ID)
-    
-    return err
+        quote.ServiceFee,
+        deposit,
+        policy,
+        lateFee,
+    ).Scan(&rental.ID, &rental.Status)
+    if err != nil {
+        return fmt.Errorf("error creating rental request: %v", err)
+    }
+
+    err = notify(tx, Notification{
+        UserID:   ownerID,
+        Kind:     NotifyRentalRequested,
+        Title:    fmt.Sprintf("New request for %s", itemName),
+        Body:     fmt.Sprintf("%s to %s, for %s.", rental.StartDate.Format("Jan 2, 15:04"), rental.EndDate.Format("Jan 2, 15:04"), formatCents(rental.TotalPrice)),
+        RentalID: &rental.ID,
+    })
+    if err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("error committing rental request: %v", err)
+    }
+    publishRentalRequested(ownerID, *rental)
+    return nil
 }
 
 
@@ -167,11 +328,58 @@ func GetAllCategories() ([]Category, error) {
 }
 
 
+// -------------- Create a new category --------------
+func CreateCategory(category *Category) error {
+    err := db.DB.QueryRow(`
+        INSERT INTO categories (c_name, c_description)
+        VALUES ($1, $2)
+        RETURNING c_id`, category.Name, category.Description).Scan(&category.ID)
+    if err != nil {
+        return fmt.Errorf("error creating category: %v", err)
+    }
+    return nil
+}
+
+// -------------- Update a category by its ID --------------
+func UpdateCategory(category *Category) (bool, error) {
+    result, err := db.DB.Exec(`
+        UPDATE categories SET c_name = $1, c_description = $2
+        WHERE c_id = $3`, category.Name, category.Description, category.ID)
+    if err != nil {
+        return false, fmt.Errorf("error updating category: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected > 0, nil
+}
+
+// -------------- Delete a category by its ID --------------
+func DeleteCategory(id int64) (bool, error) {
+    result, err := db.DB.Exec("DELETE FROM categories WHERE c_id = $1", id)
+    if err != nil {
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+            return false, ErrCategoryInUse
+        }
+        return false, fmt.Errorf("error deleting category: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return false, err
+    }
+    return rowsAffected > 0, nil
+}
+
+
 // -------------- Create a new item --------------
 func CreateItem(item *Item) error {
     query := `
-        INSERT INTO items (i_name, i_description, i_image, c_id, owner_id, i_price, i_date_listed, i_quantity, i_available)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        INSERT INTO items (i_name, i_description, c_id, owner_id, i_price, i_date_listed, i_quantity, i_available, i_deposit, i_cancellation_policy, i_late_fee)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         RETURNING i_id`  // This will return the auto-generated ID
 
     // Notice i_id is NOT in the field list above
@@ -180,13 +388,15 @@ func CreateItem(item *Item) error {
         query,
         item.Name,
         item.Description,
-        item.Image,
         item.CategoryID,
         item.OwnerID,
         item.Price,
         item.DateListed,
         item.Quantity,
         item.Available,
+        item.Deposit,
+        item.CancellationPolicy,
+        item.LateFee,
     ).Scan(&item.ID)
     
     if err != nil {
@@ -199,42 +409,107 @@ func CreateItem(item *Item) error {
 // -------------- GetItem retrieves a single item by ID --------------
 func GetItem(id int64) (Item, error) {
 	var i Item
-	err := db.DB.QueryRow("SELECT i_id, i_name, i_description, i_price, i_date_listed, i_quantity, i_available FROM items WHERE i_id = $1", id).
-		Scan(&i.ID, &i.Name, &i.Description, &i.Price, &i.DateListed, &i.Quantity, &i.Available)
+	var hasImage bool
+	err := db.DB.QueryRow(`
+		SELECT i.i_id, i.i_name, i.i_description, i.c_id, i.owner_id, i.i_price, i.i_date_listed, i.i_quantity, i.i_available, i.i_deposit, i.i_cancellation_policy, i.i_late_fee,
+			EXISTS (SELECT 1 FROM item_images im WHERE im.i_id = i.i_id),
+			COALESCE(irs.rating, 0), COALESCE(irs.review_count, 0)
+		FROM items i
+		LEFT JOIN item_rating_stats irs ON irs.i_id = i.i_id
+		WHERE i.i_id = $1`, id).
+		Scan(&i.ID, &i.Name, &i.Description, &i.CategoryID, &i.OwnerID, &i.Price, &i.DateListed, &i.Quantity, &i.Available, &i.Deposit, &i.CancellationPolicy, &i.LateFee, &hasImage, &i.Rating, &i.ReviewCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, ErrNotFound
+	}
 	if err != nil {
-		return Item{}, fmt.Errorf("error querying user: %v", err)
+		return Item{}, fmt.Errorf("error querying item: %v", err)
 	}
+	i.ImageURL = coverURL(i.ID, hasImage)
 	return i, nil
 }
 
+// -------------- GetItemOwnerID returns who listed an item, used for ownership checks --------------
+func GetItemOwnerID(id int64) (int64, error) {
+	var ownerID int64
+	err := db.DB.QueryRow("SELECT owner_id FROM items WHERE i_id = $1", id).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying item owner: %v", err)
+	}
+	return ownerID, nil
+}
+
 // -------------- Delete an item by its ID --------------
-func DeleteItem(id int64) (bool, error) {
-    result, err := db.DB.Exec("DELETE FROM items WHERE i_id = $1", id)
+// Only the owner's own items are deleted, unless anyOwner lets staff take down any listing.
+// Returns the storage keys of the item's photos, whose rows go with the item, so the
+// caller can remove the stored bytes.
+func DeleteItem(id, userID int64, anyOwner bool) (bool, []string, error) {
+    tx, err := db.DB.Begin()
     if err != nil {
-        return false, err
+        return false, nil, fmt.Errorf("error starting transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    // Lock the item so no photo is added between reading the keys and the delete
+    err = tx.QueryRow("SELECT i_id FROM items WHERE i_id = $1 AND (owner_id = $2 OR $3) FOR UPDATE", id, userID, anyOwner).Scan(&id)
+    if errors.Is(err, sql.ErrNoRows) {
+        return false, nil, nil
     }
-    
-    rowsAffected, err := result.RowsAffected()
     if err != nil {
-        return false, err
+        return false, nil, fmt.Errorf("error locking item: %v", err)
     }
-    
-    return rowsAffected > 0, nil
+
+    var keys []string
+    rows, err := tx.Query("SELECT storage_key, thumb_key FROM item_images WHERE i_id = $1", id)
+    if err != nil {
+        return false, nil, fmt.Errorf("error querying item images: %v", err)
+    }
+    for rows.Next() {
+        var key, thumbKey string
+        if err := rows.Scan(&key, &thumbKey); err != nil {
+            rows.Close()
+            return false, nil, fmt.Errorf("error scanning item image: %v", err)
+        }
+        keys = append(keys, key, thumbKey)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return false, nil, fmt.Errorf("error scanning item images: %v", err)
+    }
+
+    // The photo rows go with the item (ON DELETE CASCADE)
+    if _, err := tx.Exec("DELETE FROM items WHERE i_id = $1", id); err != nil {
+        return false, nil, fmt.Errorf("error deleting item: %v", err)
+    }
+
+    if err := tx.Commit(); err != nil {
+        return false, nil, fmt.Errorf("error committing item deletion: %v", err)
+    }
+    return true, keys, nil
 }
 
 // -------------- Update an Item by its ID  --------------
-func UpdateItem(id int64, name string, description string, image *[]byte, price int, quantity int, available bool) (Item, error) {
+// A nil deposit, policy or late fee keeps the current one, older clients don't send them.
+// Someone else's item is reported as not found.
+func UpdateItem(id, ownerID int64, name string, description string, price int, quantity int, available bool, deposit *int, policy *string, lateFee *int) (Item, error) {
     var i Item 
 
     query := ` 
         UPDATE items 
-        SET i_name = $1, i_description = $2, i_image = $3, i_price = $4, i_quantity = $5, i_available = $6
-        WHERE i_id = $7
-        RETURNING i_id, i_name, i_description, i_price, i_date_listed, i_quantity, i_available;
+        SET i_name = $1, i_description = $2, i_price = $3, i_quantity = $4, i_available = $5,
+            i_deposit = COALESCE($7, i_deposit), i_cancellation_policy = COALESCE($8, i_cancellation_policy),
+            i_late_fee = COALESCE($9, i_late_fee)
+        WHERE i_id = $6 AND owner_id = $10
+        RETURNING i_id, i_name, i_description, c_id, owner_id, i_price, i_date_listed, i_quantity, i_available, i_deposit, i_cancellation_policy, i_late_fee;
     `
 
-    err := db.DB.QueryRow(query, name, description, image, price, quantity, available, id).Scan(
-        &i.ID, &i.Name, &i.Description, &i.Price, &i.DateListed, &i.Quantity, &i.Available)
+    err := db.DB.QueryRow(query, name, description, price, quantity, available, id, deposit, policy, lateFee, ownerID).Scan(
+        &i.ID, &i.Name, &i.Description, &i.CategoryID, &i.OwnerID, &i.Price, &i.DateListed, &i.Quantity, &i.Available, &i.Deposit, &i.CancellationPolicy, &i.LateFee)
+    if errors.Is(err, sql.ErrNoRows) {
+        return Item{}, ErrNotFound
+    }
     if err != nil {
         return Item{}, fmt.Errorf("error updating item: %v", err)
     }
@@ -246,8 +521,11 @@ func UpdateItem(id int64, name string, description string, image *[]byte, price
 // -------------- Search an iten  --------------
 func SearchItems(params SearchParams) ([]Item, error) {
     query := `
-        SELECT i_id, i_name, i_description, i_image, c_id, owner_id, i_price, i_date_listed, i_quantity, i_available
-        FROM items 
+        SELECT i.i_id, i.i_name, i.i_description, i.c_id, i.owner_id, i.i_price, i.i_date_listed, i.i_quantity, i.i_available, i.i_deposit, i.i_cancellation_policy, i.i_late_fee,
+            EXISTS (SELECT 1 FROM item_images im WHERE im.i_id = i.i_id),
+            COALESCE(irs.rating, 0), COALESCE(irs.review_count, 0)
+        FROM items i
+        LEFT JOIN item_rating_stats irs ON irs.i_id = i.i_id
         WHERE 1 = 1
     `
 
@@ -256,38 +534,41 @@ func SearchItems(params SearchParams) ([]Item, error) {
 
     // Add search condition based on parameters 
     if params.Query != "" {
-        query += fmt.Sprintf(" AND (LOWER(i_name) LIKE $%d OR LOWER(i_description) LIKE $%d)", 
+        query += fmt.Sprintf(" AND (LOWER(i.i_name) LIKE $%d OR LOWER(i.i_description) LIKE $%d)", 
             argPosition, argPosition)
         args = append(args, "%"+strings.ToLower(params.Query)+"%")
         argPosition++
     }
 
     if params.CategoryID != nil {
-        query += fmt.Sprintf(" AND c_id = $%d", argPosition)
+        query += fmt.Sprintf(" AND i.c_id = $%d", argPosition)
         args = append(args, *params.CategoryID)
         argPosition++
     }
 
     if params.MinPrice != nil {
-        query += fmt.Sprintf(" AND i_price >= $%d", argPosition)
+        query += fmt.Sprintf(" AND i.i_price >= $%d", argPosition)
         args = append(args, *params.MinPrice)
         argPosition++
     }
 
     if params.MaxPrice != nil {
-        query += fmt.Sprintf(" AND i_price <= $%d", argPosition)
+        query += fmt.Sprintf(" AND i.i_price <= $%d", argPosition)
         args = append(args, *params.MaxPrice)
         argPosition++
     }
 
     if params.Available != nil {
-        query += fmt.Sprintf(" AND i_available = $%d", argPosition)
+        query += fmt.Sprintf(" AND i.i_available = $%d", argPosition)
         args = append(args, *params.Available)
         argPosition++
     }
 
+    ratingFilter, args := params.ratingClause(args)
+    query += ratingFilter
+
     // Add ordering
-    query += " ORDER BY i_date_listed DESC"
+    query += params.orderClause()
 
 
     // Execute query
@@ -300,13 +581,16 @@ func SearchItems(params SearchParams) ([]Item, error) {
     var items []Item
     for rows.Next() {
         var i Item
+        var hasImage bool
         err := rows.Scan(
-            &i.ID, &i.Name, &i.Description, &i.Image, &i.CategoryID, 
-            &i.OwnerID, &i.Price, &i.DateListed, &i.Quantity, &i.Available,
+            &i.ID, &i.Name, &i.Description, &i.CategoryID, 
+            &i.OwnerID, &i.Price, &i.DateListed, &i.Quantity, &i.Available, &i.Deposit, &i.CancellationPolicy, &i.LateFee, &hasImage,
+            &i.Rating, &i.ReviewCount,
         )
         if err != nil {
             return nil, fmt.Errorf("error scanning item: %v", err)
         }
+        i.ImageURL = coverURL(i.ID, hasImage)
         items = append(items, i)
     }
 
@@ -326,13 +610,18 @@ func GetMyRentals(userID int64) ([]map[string]interface{}, error) {
             r.end_date, 
             r.status, 
             r.total_price,
-            u.u_first_name || ' ' || u.u_last_name AS owner_name
+            u.u_first_name || ' ' || u.u_last_name AS owner_name,
+            d.d_id,
+            d.status
         FROM 
             rentals r
         JOIN 
             items i ON r.item_id = i.i_id
         JOIN 
             users u ON i.owner_id = u.u_id
+        LEFT JOIN LATERAL (
+            SELECT d_id, status FROM disputes WHERE rental_id = r.rental_id ORDER BY created_at DESC LIMIT 1
+        ) d ON TRUE
         WHERE 
             r.renter_id = $1
         ORDER BY 
@@ -351,6 +640,8 @@ func GetMyRentals(userID int64) ([]map[string]interface{}, error) {
             rentalID, itemID, totalPrice int64
             itemName, itemDescription, status, ownerName string
             startDate, endDate time.Time
+            disputeID *int64
+            disputeStatus *string
         )
         
         err := rows.Scan(
@@ -363,6 +654,8 @@ func GetMyRentals(userID int64) ([]map[string]interface{}, error) {
             &status, 
             &totalPrice,
             &ownerName,
+            &disputeID,
+            &disputeStatus,
         )
         if err != nil {
             return nil, fmt.Errorf("error scanning rental: %v", err)
@@ -378,6 +671,8 @@ func GetMyRentals(userID int64) ([]map[string]interface{}, error) {
             "status":       status,
             "total_price":  totalPrice,
             "owner_name":   ownerName,
+            "dispute_id":   disputeID,     // latest dispute, nil without one
+            "dispute_status": disputeStatus,
         }
         
         rentals = append(rentals, rental)
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Notification kinds
+const (
+	NotifyRentalRequested    = "rental_requested"
+	NotifyRentalStatus       = "rental_status"
+	NotifyRentalOverdue      = "rental_overdue"
+	NotifyExtensionRequested = "extension_requested"
+	NotifyExtensionDecided   = "extension_decided"
+	NotifyDisputeOpened      = "dispute_opened"
+	NotifyDisputeResponded   = "dispute_responded"
+	NotifyDisputeResolved    = "dispute_resolved"
+	NotifyDamageClaimFiled   = "damage_claim_filed"
+)
+
+// Inbox page sizes
+const (
+	DefaultNotificationPage = 50
+	MaxNotificationPage     = 100
+)
+
+// MaxDeliveryAttempts is how often a channel is tried before a delivery is given up on
+const MaxDeliveryAttempts = 8
+
+// ErrNotificationChannel is recorded on deliveries for a channel that is no longer configured
+var ErrNotificationChannel = errors.New("notification channel not configured")
+
+// Notification is an in-app message for one user
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Kind      string     `json:"kind"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	RentalID  *int64     `json:"rental_id,omitempty"` // nullable
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"` // nil while unread
+}
+
+// NotificationPage is a page of the inbox, newest first. NextBefore is set while there are older ones.
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	NextBefore    *int64         `json:"next_before,omitempty"`
+}
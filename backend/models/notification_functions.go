@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/LuaanNguyen/backend/notifications"
+)
+
+// notify records a notification inside the caller's transaction, so it only exists
+// if whatever it tells about was committed too. Its deliveries go into the outbox
+// with it, one per configured channel the user wants, for the dispatcher to send.
+func notify(tx *sql.Tx, n Notification) error {
+	delivery, err := deliveryFor(tx, n.UserID, n.Kind)
+	if err != nil {
+		return err
+	}
+	if delivery == DeliveryOff {
+		return nil
+	}
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO notifications (u_id, kind, title, body, rental_id, digest_pending)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING n_id`, n.UserID, n.Kind, n.Title, n.Body, n.RentalID, delivery == DeliveryDigest).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("error creating notification: %v", err)
+	}
+
+	for _, channel := range notifications.ChannelNames() {
+		switch {
+		case delivery == DeliveryInApp && channel != "inapp":
+			continue
+		case delivery == DeliveryDigest && channel == "email":
+			continue // the digest job emails it
+		}
+
+		// Emails wait for the end of the user's quiet hours
+		var nextAttempt *time.Time
+		if channel == "email" {
+			settings, err := loadSettings(tx, n.UserID)
+			if err != nil {
+				return err
+			}
+			if until, quiet := settings.quietUntil(time.Now()); quiet {
+				nextAttempt = &until
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO notification_outbox (n_id, channel, next_attempt_at)
+			VALUES ($1, $2, COALESCE($3, CURRENT_TIMESTAMP))`, id, channel, nextAttempt)
+		if err != nil {
+			return fmt.Errorf("error queueing notification: %v", err)
+		}
+	}
+	return nil
+}
+
+const notificationSelect = `
+	SELECT n_id, u_id, kind, title, body, rental_id, created_at, read_at
+	FROM notifications`
+
+func scanNotification(row rowScanner) (Notification, error) {
+	var n Notification
+	err := row.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &n.RentalID, &n.CreatedAt, &n.ReadAt)
+	return n, err
+}
+
+// -------------- Get a page of the user's notifications, newest first --------------
+// before is the ID of the oldest notification already shown, 0 for the latest page.
+func GetNotifications(userID int64, unreadOnly bool, before int64, limit int) (NotificationPage, error) {
+	query := notificationSelect + " WHERE u_id = $1"
+	args := []interface{}{userID}
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	if before > 0 {
+		args = append(args, before)
+		query += fmt.Sprintf(" AND n_id < $%d", len(args))
+	}
+	// One extra row tells whether there is an older page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY n_id DESC LIMIT $%d", len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return NotificationPage{}, fmt.Errorf("error querying notifications: %v", err)
+	}
+	defer rows.Close()
+
+	page := NotificationPage{Notifications: []Notification{}}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return NotificationPage{}, fmt.Errorf("error scanning notification: %v", err)
+		}
+		page.Notifications = append(page.Notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return NotificationPage{}, fmt.Errorf("error scanning notifications: %v", err)
+	}
+
+	if len(page.Notifications) > limit {
+		page.Notifications = page.Notifications[:limit]
+		page.NextBefore = &page.Notifications[limit-1].ID
+	}
+	return page, nil
+}
+
+// -------------- Count the user's unread notifications --------------
+func GetUnreadNotificationCount(userID int64) (int, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE u_id = $1 AND read_at IS NULL", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting unread notifications: %v", err)
+	}
+	return count, nil
+}
+
+// -------------- Mark one of the user's notifications as read --------------
+// Someone else's notification is reported as not found.
+func MarkNotificationRead(id, userID int64) (Notification, error) {
+	n, err := scanNotification(db.DB.QueryRow(`
+		UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE n_id = $1 AND u_id = $2
+		RETURNING n_id, u_id, kind, title, body, rental_id, created_at, read_at`, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotFound
+	}
+	if err != nil {
+		return Notification{}, fmt.Errorf("error marking notification read: %v", err)
+	}
+	return n, nil
+}
+
+// -------------- Mark all of the user's notifications as read --------------
+// Returns how many were newly read.
+func MarkAllNotificationsRead(userID int64) (int64, error) {
+	result, err := db.DB.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE u_id = $1 AND read_at IS NULL", userID)
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications read: %v", err)
+	}
+	read, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications read: %v", err)
+	}
+	return read, nil
+}
+
+// -------------- Deliver due notifications from the outbox --------------
+
+const (
+	// dispatchBatch is how many deliveries one dispatch claims
+	dispatchBatch = 100
+	// deliveryLease is how long a claimed delivery is left alone before it counts as abandoned
+	deliveryLease = 5 * time.Minute
+)
+
+// deliveryBackoff is the wait after a failed attempt: 30s, doubling up to 6h
+func deliveryBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < 6*time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > 6*time.Hour {
+		backoff = 6 * time.Hour
+	}
+	return backoff
+}
+
+type delivery struct {
+	id       int64
+	channel  string
+	attempts int
+	message  notifications.Message
+}
+
+// DispatchNotifications sends the deliveries that are due and returns how many went out.
+// Several dispatchers can run at once; each claims its own rows.
+func DispatchNotifications(now time.Time) (int, error) {
+	deliveries, err := claimDeliveries(now)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range deliveries {
+		sendErr := ErrNotificationChannel
+		if channel := notifications.Lookup(d.channel); channel != nil {
+			sendErr = channel.Send(d.message)
+		}
+		if err := recordDelivery(d, sendErr, time.Now()); err != nil {
+			return sent, err
+		}
+		if sendErr == nil {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// claimDeliveries takes up to a batch of due deliveries, counting the attempt and
+// leasing them so no other dispatcher picks them up meanwhile
+func claimDeliveries(now time.Time) ([]delivery, error) {
+	rows, err := db.DB.Query(`
+		UPDATE notification_outbox o
+		SET attempts = o.attempts + 1, next_attempt_at = $1
+		FROM (
+			SELECT o_id FROM notification_outbox
+			WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		) due, notifications n, users u
+		WHERE o.o_id = due.o_id AND n.n_id = o.n_id AND u.u_id = n.u_id
+		RETURNING o.o_id, o.channel, o.attempts, n.n_id, n.u_id, COALESCE(u.u_email, ''), n.kind, n.title, n.body, n.rental_id, n.created_at`,
+		now.Add(deliveryLease), now, dispatchBatch)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming notifications: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []delivery
+	for rows.Next() {
+		var d delivery
+		m := &d.message
+		err := rows.Scan(&d.id, &d.channel, &d.attempts, &m.ID, &m.UserID, &m.Email, &m.Kind, &m.Title, &m.Body, &m.RentalID, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning notification: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// recordDelivery marks a delivery sent, or schedules its retry after sendErr.
+// Undeliverable messages and the last attempt are given up on.
+func recordDelivery(d delivery, sendErr error, now time.Time) error {
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = db.DB.Exec("UPDATE notification_outbox SET delivered_at = $1, last_error = NULL WHERE o_id = $2", now, d.id)
+	case errors.Is(sendErr, notifications.ErrUndeliverable) || errors.Is(sendErr, ErrNotificationChannel) || d.attempts >= MaxDeliveryAttempts:
+		log.Printf("Giving up on %s notification %d after %d attempts: %v", d.channel, d.message.ID, d.attempts, sendErr)
+		_, err = db.DB.Exec("UPDATE notification_outbox SET failed_at = $1, last_error = $2 WHERE o_id = $3", now, sendErr.Error(), d.id)
+	default:
+		_, err = db.DB.Exec("UPDATE notification_outbox SET next_attempt_at = $1, last_error = $2 WHERE o_id = $3",
+			now.Add(deliveryBackoff(d.attempts)), sendErr.Error(), d.id)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording notification delivery: %v", err)
+	}
+	return nil
+}
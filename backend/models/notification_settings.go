@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// How a user wants a kind of notification delivered
+const (
+	DeliveryImmediate = "immediate" // every configured channel, email right away
+	DeliveryDigest    = "digest"    // in the daily digest email instead of one email each
+	DeliveryInApp     = "inapp"     // only the inbox and live updates
+	DeliveryOff       = "off"       // not at all
+)
+
+// NotificationKinds are the kinds users can set a delivery for
+var NotificationKinds = []string{
+	NotifyRentalRequested,
+	NotifyRentalStatus,
+	NotifyRentalOverdue,
+	NotifyExtensionRequested,
+	NotifyExtensionDecided,
+	NotifyDisputeOpened,
+	NotifyDisputeResponded,
+	NotifyDisputeResolved,
+	NotifyDamageClaimFiled,
+}
+
+// DigestHour is the local hour from which the daily digest goes out, quiet hours permitting
+const DigestHour = 8
+
+// ErrInvalidSettings is returned for an unknown time zone, kind or delivery, or malformed quiet hours
+var ErrInvalidSettings = errors.New("invalid notification settings")
+
+// NotificationSettings are a user's notification preferences. QuietStart and QuietEnd are
+// "15:04" wall clock times in TimeZone; emails due in between wait until QuietEnd.
+type NotificationSettings struct {
+	TimeZone   string            `json:"time_zone"`
+	QuietStart *string           `json:"quiet_start"` // nil for no quiet hours
+	QuietEnd   *string           `json:"quiet_end"`
+	Kinds      map[string]string `json:"kinds"` // kind to delivery, every kind is listed
+}
+
+// location is the user's time zone, UTC if it can't be loaded
+func (s NotificationSettings) location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// quietUntil reports whether now falls in the quiet hours and, if so, when they end.
+// Quiet hours may wrap midnight, e.g. 22:00 to 07:00.
+func (s NotificationSettings) quietUntil(now time.Time) (time.Time, bool) {
+	if s.QuietStart == nil || s.QuietEnd == nil {
+		return time.Time{}, false
+	}
+	start, err1 := time.Parse("15:04", *s.QuietStart)
+	end, err2 := time.Parse("15:04", *s.QuietEnd)
+	if err1 != nil || err2 != nil || start.Equal(end) {
+		return time.Time{}, false
+	}
+
+	local := now.In(s.location())
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	quiet := startMinute <= minute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, local.Location())
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	_ "time/tzdata" // users pick IANA time zones, don't depend on the host having them
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// loadSettings reads the user's time zone and quiet hours, the defaults if they never set any
+func loadSettings(tx *sql.Tx, userID int64) (NotificationSettings, error) {
+	var s NotificationSettings
+	err := tx.QueryRow(`
+		SELECT time_zone, to_char(quiet_start, 'HH24:MI'), to_char(quiet_end, 'HH24:MI')
+		FROM notification_settings WHERE u_id = $1`, userID).Scan(&s.TimeZone, &s.QuietStart, &s.QuietEnd)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationSettings{TimeZone: "UTC"}, nil
+	}
+	if err != nil {
+		return NotificationSettings{}, fmt.Errorf("error querying notification settings: %v", err)
+	}
+	return s, nil
+}
+
+// deliveryFor returns how the user wants notifications of the kind delivered
+func deliveryFor(tx *sql.Tx, userID int64, kind string) (string, error) {
+	delivery := DeliveryImmediate
+	err := tx.QueryRow("SELECT delivery FROM notification_preferences WHERE u_id = $1 AND kind = $2", userID, kind).Scan(&delivery)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("error querying notification preference: %v", err)
+	}
+	return delivery, nil
+}
+
+// -------------- Get the user's notification settings --------------
+func GetNotificationSettings(userID int64) (NotificationSettings, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return NotificationSettings{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	s, err := loadSettings(tx, userID)
+	if err != nil {
+		return NotificationSettings{}, err
+	}
+
+	s.Kinds = make(map[string]string, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		s.Kinds[kind] = DeliveryImmediate
+	}
+	rows, err := tx.Query("SELECT kind, delivery FROM notification_preferences WHERE u_id = $1", userID)
+	if err != nil {
+		return NotificationSettings{}, fmt.Errorf("error querying notification preferences: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, delivery string
+		if err := rows.Scan(&kind, &delivery); err != nil {
+			return NotificationSettings{}, fmt.Errorf("error scanning notification preference: %v", err)
+		}
+		s.Kinds[kind] = delivery
+	}
+	if err := rows.Err(); err != nil {
+		return NotificationSettings{}, fmt.Errorf("error scanning notification preferences: %v", err)
+	}
+	return s, nil
+}
+
+func validDelivery(delivery string) bool {
+	switch delivery {
+	case DeliveryImmediate, DeliveryDigest, DeliveryInApp, DeliveryOff:
+		return true
+	}
+	return false
+}
+
+func validKind(kind string) bool {
+	for _, k := range NotificationKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// validQuietHours checks that both or neither are set, as distinct "15:04" times
+func validQuietHours(start, end *string) bool {
+	if start == nil || end == nil {
+		return start == end
+	}
+	s, err1 := time.Parse("15:04", *start)
+	e, err2 := time.Parse("15:04", *end)
+	return err1 == nil && err2 == nil && !s.Equal(e)
+}
+
+// -------------- Update the user's notification settings --------------
+// The time zone (UTC if empty) and quiet hours are replaced; only the kinds sent are changed.
+func UpdateNotificationSettings(userID int64, s NotificationSettings) (NotificationSettings, error) {
+	if s.TimeZone == "" {
+		s.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return NotificationSettings{}, ErrInvalidSettings
+	}
+	if !validQuietHours(s.QuietStart, s.QuietEnd) {
+		return NotificationSettings{}, ErrInvalidSettings
+	}
+	for kind, delivery := range s.Kinds {
+		if !validKind(kind) || !validDelivery(delivery) {
+			return NotificationSettings{}, ErrInvalidSettings
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return NotificationSettings{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_settings (u_id, time_zone, quiet_start, quiet_end)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (u_id) DO UPDATE
+		SET time_zone = EXCLUDED.time_zone, quiet_start = EXCLUDED.quiet_start, quiet_end = EXCLUDED.quiet_end`,
+		userID, s.TimeZone, s.QuietStart, s.QuietEnd)
+	if err != nil {
+		return NotificationSettings{}, fmt.Errorf("error saving notification settings: %v", err)
+	}
+
+	for kind, delivery := range s.Kinds {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (u_id, kind, delivery)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (u_id, kind) DO UPDATE SET delivery = EXCLUDED.delivery`, userID, kind, delivery)
+		if err != nil {
+			return NotificationSettings{}, fmt.Errorf("error saving notification preference: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return NotificationSettings{}, fmt.Errorf("error committing notification settings: %v", err)
+	}
+	return GetNotificationSettings(userID)
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func quietSettings(zone, start, end string) NotificationSettings {
+	return NotificationSettings{TimeZone: zone, QuietStart: &start, QuietEnd: &end}
+}
+
+func TestQuietUntil(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading time zone: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		settings  NotificationSettings
+		now       time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{
+			name:     "no quiet hours",
+			settings: NotificationSettings{TimeZone: "UTC"},
+			now:      time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "start equals end",
+			settings: quietSettings("UTC", "22:00", "22:00"),
+			now:      time.Date(2026, 5, 4, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "same day window",
+			settings:  quietSettings("UTC", "13:00", "14:30"),
+			now:       time.Date(2026, 5, 4, 13, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 5, 4, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "same day window, at the end",
+			settings: quietSettings("UTC", "13:00", "14:30"),
+			now:      time.Date(2026, 5, 4, 14, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "wraps midnight, before midnight",
+			settings:  quietSettings("UTC", "22:00", "07:00"),
+			now:       time.Date(2026, 5, 4, 23, 15, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "wraps midnight, after midnight",
+			settings:  quietSettings("UTC", "22:00", "07:00"),
+			now:       time.Date(2026, 5, 5, 3, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "wraps midnight, outside",
+			settings: quietSettings("UTC", "22:00", "07:00"),
+			now:      time.Date(2026, 5, 5, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "in the user's zone, not UTC",
+			settings:  quietSettings("America/New_York", "22:00", "07:00"),
+			now:       time.Date(2026, 5, 5, 2, 30, 0, 0, time.UTC), // 22:30 EDT
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 5, 5, 7, 0, 0, 0, ny),
+		},
+		{
+			name:      "night the clocks go forward",
+			settings:  quietSettings("America/New_York", "22:00", "07:00"),
+			now:       time.Date(2026, 3, 7, 23, 0, 0, 0, ny), // EST, 07:00 is EDT
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 3, 8, 7, 0, 0, 0, ny),
+		},
+		{
+			name:      "night the clocks go back",
+			settings:  quietSettings("America/New_York", "22:00", "07:00"),
+			now:       time.Date(2026, 10, 31, 23, 0, 0, 0, ny), // EDT, 07:00 is EST
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 11, 1, 7, 0, 0, 0, ny),
+		},
+		{
+			name:      "unknown zone falls back to UTC",
+			settings:  quietSettings("Nowhere/Atlantis", "22:00", "07:00"),
+			now:       time.Date(2026, 5, 4, 23, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2026, 5, 5, 7, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.settings.quietUntil(tt.now)
+			if quiet != tt.wantQuiet {
+				t.Fatalf("quietUntil(%v) quiet = %v, want %v", tt.now, quiet, tt.wantQuiet)
+			}
+			if quiet && !until.Equal(tt.wantUntil) {
+				t.Errorf("quietUntil(%v) = %v, want %v", tt.now, until, tt.wantUntil)
+			}
+		})
+	}
+}
+
+// The quiet night around a DST change is an hour shorter or longer in real time
+func TestQuietUntilAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loading time zone: %v", err)
+	}
+	settings := quietSettings("America/New_York", "22:00", "07:00")
+
+	for _, tt := range []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{time.Date(2026, 3, 7, 22, 0, 0, 0, ny), 8 * time.Hour},
+		{time.Date(2026, 10, 31, 22, 0, 0, 0, ny), 10 * time.Hour},
+	} {
+		until, quiet := settings.quietUntil(tt.now)
+		if !quiet {
+			t.Fatalf("quietUntil(%v) isn't quiet", tt.now)
+		}
+		if got := until.Sub(tt.now); got != tt.want {
+			t.Errorf("quiet night from %v lasts %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInvalidDates is returned when a rental doesn't end after it starts or starts in the past
+var ErrInvalidDates = errors.New("invalid rental dates")
+
+// ErrItemUnavailable is returned when renting an item the owner has unlisted
+var ErrItemUnavailable = errors.New("item is not available")
+
+// OverlapError is returned when a booking would put more units out than the item has.
+// Start and End bound the first window in which the item is fully booked.
+type OverlapError struct {
+	Start time.Time `json:"conflict_start"`
+	End   time.Time `json:"conflict_end"`
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("item is fully booked from %s to %s", e.Start.Format(time.RFC3339), e.End.Format(time.RFC3339))
+}
+
+// dateRange is a half-open [Start, End) window during which Units of the item are taken
+type dateRange struct {
+	Start time.Time
+	End   time.Time
+	Units int
+}
+
+// findOverbooking sweeps the existing bookings overlapping [start, end) and
+// returns the first window where adding one more booking would exceed quantity,
+// or nil if the new booking fits.
+func findOverbooking(bookings []dateRange, start, end time.Time, quantity int) *OverlapError {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+
+	var events []event
+	for _, b := range bookings {
+		// Only the part inside the requested window matters
+		s, e := b.Start, b.End
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if !s.Before(e) {
+			continue
+		}
+		events = append(events, event{s, b.Units}, event{e, -b.Units})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	if quantity <= 0 {
+		return &OverlapError{Start: start, End: end}
+	}
+
+	booked := 0
+	var conflict *OverlapError
+	for i, ev := range events {
+		booked += ev.delta
+		// Apply every event at the same instant before judging, so a hand-over doesn't split the window
+		if i+1 < len(events) && events[i+1].at.Equal(ev.at) {
+			continue
+		}
+		if conflict == nil && booked+1 > quantity {
+			conflict = &OverlapError{Start: ev.at}
+		} else if conflict != nil && booked+1 <= quantity {
+			conflict.End = ev.at
+			return conflict
+		}
+	}
+	if conflict != nil {
+		conflict.End = end
+	}
+	return conflict
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/payments"
+)
+
+// ErrPaymentDeclined is returned when the payment provider refuses a rental's payment
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// paymentError keeps declines recognizable for the handlers and wraps everything else
+func paymentError(action string, err error) error {
+	if errors.Is(err, payments.ErrDeclined) {
+		return ErrPaymentDeclined
+	}
+	return fmt.Errorf("error %s payment: %v", action, err)
+}
+
+// rentalReference identifies a rental to the payment provider
+func rentalReference(rental Rental) string {
+	return fmt.Sprintf("rental-%d", rental.ID)
+}
+
+// settleRental moves the money for a rental status change and books it in the ledger, inside
+// the caller's transaction. Approval authorizes the total and the deposit, completion captures
+// the total, pays the owner and releases the deposit, unless a dispute holds the payment.
+// Cancelling an approved rental releases the deposit and refunds what the cancellation policy allows.
+// Authorizations only hold money and are released if the change doesn't commit; captures, refunds
+// and payouts are queued and sent by settlePayments once it has.
+func settleRental(tx *sql.Tx, rental *Rental, party, from, to string) error {
+	switch {
+	case to == RentalApproved:
+		if err := authorizeRental(tx, rental); err != nil {
+			// Whatever was authorized before the failure would otherwise stay held
+			releaseHolds(*rental)
+			return err
+		}
+		return nil
+
+	case to == RentalCompleted:
+		// Only a checkin can be late
+		if from == RentalActive {
+			if err := settleLateReturn(tx, rental); err != nil {
+				return err
+			}
+		}
+		// A dispute holds the payment until a moderator rules on it
+		disputed, err := hasOpenDispute(tx, rental.ID)
+		if err != nil {
+			return err
+		}
+		if !disputed {
+			if err := capturePayment(tx, rental); err != nil {
+				return err
+			}
+		}
+		// A successful return gives the deposit back, unless the owner has a claim on it
+		pending, err := hasPendingClaim(tx, rental.ID)
+		if err != nil || pending {
+			return err
+		}
+		return settleDeposit(tx, rental, 0)
+
+	case to == RentalCancelled && from == RentalApproved:
+		pending, err := hasPendingClaim(tx, rental.ID)
+		if err != nil {
+			return err
+		}
+		if pending {
+			return ErrClaimPending
+		}
+		disputed, err := hasOpenDispute(tx, rental.ID)
+		if err != nil {
+			return err
+		}
+		if disputed {
+			return ErrDisputePending
+		}
+		if err := settleDeposit(tx, rental, 0); err != nil {
+			return err
+		}
+		// The renter was already charged, pending rentals never were
+		return refundCancellation(tx, rental, party)
+	}
+	return nil
+}
+
+// authorizeRental holds the total and the deposit on the renter's payment method and books
+// them. The payment IDs are set on rental as soon as they exist, so the caller can release
+// them if anything fails.
+func authorizeRental(tx *sql.Tx, rental *Rental) error {
+	if rental.TotalPrice > 0 {
+		paymentID, err := payments.Default.Authorize(rental.RenterID, rental.TotalPrice, rentalReference(*rental))
+		if err != nil {
+			return paymentError("authorizing", err)
+		}
+		rental.PaymentID = &paymentID
+		if _, err := tx.Exec("UPDATE rentals SET payment_id = $1 WHERE rental_id = $2", paymentID, rental.ID); err != nil {
+			return fmt.Errorf("error saving rental payment: %v", err)
+		}
+	}
+	if err := postTransaction(tx, &rental.RenterID, TxCharge, *rental, rental.TotalPrice, rental.PaymentID); err != nil {
+		return err
+	}
+	return holdDeposit(tx, rental)
+}
+
+// capturePayment takes the whole total of a completed rental and pays the owner their share
+func capturePayment(tx *sql.Tx, rental *Rental) error {
+	// Rentals approved before payments existed were never charged, so there is nothing to pay out either
+	if rental.PaymentID == nil {
+		return nil
+	}
+	if err := queueCapture(tx, *rental, *rental.PaymentID, rental.TotalPrice, "capture"); err != nil {
+		return err
+	}
+	if err := postPayout(tx, *rental, rental.TotalPrice-rental.ServiceFee, "payout"); err != nil {
+		return err
+	}
+	return postTransaction(tx, nil, TxFee, *rental, rental.ServiceFee, rental.PaymentID)
+}
+
+// refundCancellation gives the renter back what the rental's cancellation policy allows
+func refundCancellation(tx *sql.Tx, rental *Rental, party string) error {
+	return settleWithRefund(tx, rental, CalculateRefund(*rental, party, time.Now()).Amount)
+}
+
+// settleWithRefund gives refund of the authorized total back to the renter and pays the owner for
+// the rest, minus the matching share of the service fee. The refund is saved on the rental.
+func settleWithRefund(tx *sql.Tx, rental *Rental, refund int64) error {
+	rental.RefundAmount = &refund
+	if _, err := tx.Exec("UPDATE rentals SET refund_amount = $1 WHERE rental_id = $2", refund, rental.ID); err != nil {
+		return fmt.Errorf("error saving rental refund: %v", err)
+	}
+	// Rentals approved before payments existed were never charged, there is nothing to give back or pay out
+	if rental.PaymentID == nil {
+		return nil
+	}
+
+	kept := rental.TotalPrice - refund
+	var fee int64
+	if rental.TotalPrice > 0 {
+		fee = kept * rental.ServiceFee / rental.TotalPrice
+	}
+
+	// Capturing what the owner keeps releases the refund, nothing is captured to be paid back
+	if kept > 0 {
+		if err := queueCapture(tx, *rental, *rental.PaymentID, kept, "capture"); err != nil {
+			return err
+		}
+	} else if err := queueRelease(tx, *rental, *rental.PaymentID, rental.TotalPrice, "release"); err != nil {
+		return err
+	}
+	if err := postPayout(tx, *rental, kept-fee, "payout"); err != nil {
+		return err
+	}
+	if err := postTransaction(tx, &rental.RenterID, TxRefund, *rental, refund, rental.PaymentID); err != nil {
+		return err
+	}
+	return postTransaction(tx, nil, TxFee, *rental, fee, rental.PaymentID)
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/LuaanNguyen/backend/payments"
+)
+
+// Kinds of queued payment operations
+const (
+	opCharge  = "charge" // authorize and capture in one go
+	opCapture = "capture"
+	opRelease = "release"
+	opPayout  = "payout"
+)
+
+// MaxPaymentAttempts is how often a provider call is tried before it's left for someone to sort out
+const MaxPaymentAttempts = 8
+
+const (
+	// paymentBatch is how many operations one run claims at a time
+	paymentBatch = 100
+	// paymentLease is how long a claimed operation is left alone before it counts as abandoned
+	paymentLease = 5 * time.Minute
+)
+
+// paymentOp is a charge, capture, release or payout waiting in payment_operations
+type paymentOp struct {
+	id        int64
+	rentalID  int64
+	kind      string
+	paymentID *string // captures and releases
+	accountID *int64  // charges and payouts
+	amount    int64
+	reference string
+	ledgerID  *int64 // the Payout entry of a payout
+	attempts  int
+}
+
+// queuePayment writes a provider call to make once the caller's transaction has committed.
+// step names it within the rental (e.g. "capture") and makes up its idempotency key, so
+// queueing the same step twice only sends it once.
+func queuePayment(tx *sql.Tx, rental Rental, step string, op paymentOp) error {
+	if op.amount <= 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO payment_operations (rental_id, kind, payment_id, account_id, amount, reference, t_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (reference) DO NOTHING`,
+		rental.ID, op.kind, op.paymentID, op.accountID, op.amount, rentalReference(rental)+"-"+step, op.ledgerID)
+	if err != nil {
+		return fmt.Errorf("error queueing %s: %v", op.kind, err)
+	}
+	return nil
+}
+
+// queueCapture queues taking amount of an authorized payment, which releases the rest of it
+func queueCapture(tx *sql.Tx, rental Rental, paymentID string, amount int64, step string) error {
+	return queuePayment(tx, rental, step, paymentOp{kind: opCapture, paymentID: &paymentID, amount: amount})
+}
+
+// queueRelease queues giving back the hold of a payment that won't be captured. amount is the
+// held amount, kept for the record.
+func queueRelease(tx *sql.Tx, rental Rental, paymentID string, amount int64, step string) error {
+	return queuePayment(tx, rental, step, paymentOp{kind: opRelease, paymentID: &paymentID, amount: amount})
+}
+
+// postPayout books a Payout to the rental's owner and queues sending it. The entry gets the
+// provider's payout ID once the payout went out.
+func postPayout(tx *sql.Tx, rental Rental, amount int64, step string) error {
+	if amount <= 0 {
+		return nil
+	}
+	var ledgerID int64
+	err := tx.QueryRow(`
+		INSERT INTO transactions (u_id, t_type, i_id, rental_id, t_amount)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING t_id`, rental.OwnerID, TxPayout, rental.ItemID, rental.ID, amount).Scan(&ledgerID)
+	if err != nil {
+		return fmt.Errorf("error posting %s transaction: %v", TxPayout, err)
+	}
+	return queuePayment(tx, rental, step, paymentOp{kind: opPayout, accountID: &rental.OwnerID, amount: amount, ledgerID: &ledgerID})
+}
+
+// releaseAuthorization gives back an authorization made for a change that was rolled back. The
+// release is queued on its own, so one the provider refuses stays on record and is retried like
+// any other operation.
+func releaseAuthorization(rental Rental, paymentID string, amount int64, step string) {
+	if err := queueReleaseNow(rental, paymentID, amount, step); err != nil {
+		log.Printf("Payment %s of rental %d is still held, queueing its release failed: %v", paymentID, rental.ID, err)
+		return
+	}
+	settlePayments(rental.ID)
+}
+
+func queueReleaseNow(rental Rental, paymentID string, amount int64, step string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := queueRelease(tx, rental, paymentID, amount, step); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// -------------- Send queued payment operations to the provider --------------
+
+// settlePayments sends what a change to the rental queued, right after it committed.
+// Whatever fails is left to the background job.
+func settlePayments(rentalID int64) {
+	if _, err := processPayments(&rentalID, time.Now()); err != nil {
+		log.Printf("Payments for rental %d failed: %v", rentalID, err)
+	}
+}
+
+// ProcessPayments sends the payment operations that are due and returns how many went through.
+// Several workers can run at once; each claims its own rows.
+func ProcessPayments(now time.Time) (int, error) {
+	return processPayments(nil, now)
+}
+
+// processPayments works off the due operations, of one rental or all of them. Finishing an
+// operation makes the next one of its rental due, so it claims again until nothing is left.
+func processPayments(rentalID *int64, now time.Time) (int, error) {
+	done := 0
+	for {
+		ops, err := claimPayments(rentalID, now)
+		if err != nil || len(ops) == 0 {
+			return done, err
+		}
+		for _, op := range ops {
+			payoutID, callErr := runPayment(op)
+			if err := recordPayment(op, payoutID, callErr, time.Now()); err != nil {
+				return done, err
+			}
+			if callErr == nil {
+				done++
+			}
+		}
+	}
+}
+
+// claimPayments takes up to a batch of due operations, only the oldest unfinished one of each
+// rental, counting the attempt and leasing them so no other worker picks them up meanwhile
+func claimPayments(rentalID *int64, now time.Time) ([]paymentOp, error) {
+	rows, err := db.DB.Query(`
+		UPDATE payment_operations p
+		SET attempts = p.attempts + 1, next_attempt_at = $1
+		FROM (
+			SELECT po_id FROM payment_operations o
+			WHERE done_at IS NULL AND failed_at IS NULL AND next_attempt_at <= $2
+				AND ($4::int IS NULL OR rental_id = $4)
+				AND NOT EXISTS (
+					SELECT 1 FROM payment_operations earlier
+					WHERE earlier.rental_id = o.rental_id AND earlier.po_id < o.po_id AND earlier.done_at IS NULL)
+			ORDER BY po_id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE p.po_id = due.po_id
+		RETURNING p.po_id, p.rental_id, p.kind, p.payment_id, p.account_id, p.amount, p.reference, p.t_id, p.attempts`,
+		now.Add(paymentLease), now, paymentBatch, rentalID)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming payment operations: %v", err)
+	}
+	defer rows.Close()
+
+	var ops []paymentOp
+	for rows.Next() {
+		var op paymentOp
+		err := rows.Scan(&op.id, &op.rentalID, &op.kind, &op.paymentID, &op.accountID, &op.amount, &op.reference, &op.ledgerID, &op.attempts)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payment operation: %v", err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+// runPayment makes the provider call, returning the payout ID for payouts
+func runPayment(op paymentOp) (string, error) {
+	switch {
+	case op.kind == opCharge && op.accountID != nil:
+		paymentID, err := payments.Default.Authorize(*op.accountID, op.amount, op.reference)
+		if err != nil {
+			return "", err
+		}
+		return "", payments.Default.Capture(paymentID, op.amount, op.reference+"-capture")
+	case op.kind == opCapture && op.paymentID != nil:
+		return "", payments.Default.Capture(*op.paymentID, op.amount, op.reference)
+	case op.kind == opRelease && op.paymentID != nil:
+		return "", payments.Default.Release(*op.paymentID, op.reference)
+	case op.kind == opPayout && op.accountID != nil:
+		return payments.Default.Payout(*op.accountID, op.amount, op.reference)
+	}
+	return "", fmt.Errorf("malformed %s operation %d: %w", op.kind, op.id, payments.ErrDeclined)
+}
+
+// recordPayment marks an operation done, or schedules its retry after callErr. Declines and
+// the last attempt are given up on and hold back the rest of the rental's operations.
+func recordPayment(op paymentOp, payoutID string, callErr error, now time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	switch {
+	case callErr == nil:
+		_, err = tx.Exec("UPDATE payment_operations SET done_at = $1, last_error = NULL WHERE po_id = $2", now, op.id)
+		if err == nil && op.ledgerID != nil && payoutID != "" {
+			_, err = tx.Exec("UPDATE transactions SET t_reference = $1 WHERE t_id = $2", payoutID, *op.ledgerID)
+		}
+	case errors.Is(callErr, payments.ErrDeclined) || errors.Is(callErr, payments.ErrUnknownPayment) || op.attempts >= MaxPaymentAttempts:
+		log.Printf("Giving up on %s %s after %d attempts: %v", op.kind, op.reference, op.attempts, callErr)
+		_, err = tx.Exec("UPDATE payment_operations SET failed_at = $1, last_error = $2 WHERE po_id = $3", now, callErr.Error(), op.id)
+	default:
+		_, err = tx.Exec("UPDATE payment_operations SET next_attempt_at = $1, last_error = $2 WHERE po_id = $3",
+			now.Add(deliveryBackoff(op.attempts)), callErr.Error(), op.id)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording %s: %v", op.kind, err)
+	}
+	return tx.Commit()
+}
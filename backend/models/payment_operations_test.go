@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LuaanNguyen/backend/payments"
+)
+
+func useFakeProvider(t *testing.T) *payments.FakeProvider {
+	t.Helper()
+	previous := payments.Default
+	fake := payments.NewFakeProvider()
+	payments.Default = fake
+	t.Cleanup(func() { payments.Default = previous })
+	return fake
+}
+
+func TestRunPayment(t *testing.T) {
+	fake := useFakeProvider(t)
+	renter, owner := int64(2), int64(1)
+
+	paymentID, err := fake.Authorize(renter, 5000, "rental-7")
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	capture := paymentOp{id: 1, kind: opCapture, paymentID: &paymentID, amount: 4000, reference: "rental-7-capture"}
+	if _, err := runPayment(capture); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	// A retried operation after a crash between the call and recording it
+	if _, err := runPayment(capture); err != nil {
+		t.Errorf("retried capture: %v", err)
+	}
+
+	payout := paymentOp{id: 2, kind: opPayout, accountID: &owner, amount: 3600, reference: "rental-7-payout"}
+	payoutID, err := runPayment(payout)
+	if err != nil || payoutID == "" {
+		t.Errorf("payout = %q, %v", payoutID, err)
+	}
+
+	// The capture took the hold, so a release is declined and would be given up on
+	release := paymentOp{id: 3, kind: opRelease, paymentID: &paymentID, amount: 5000, reference: "rental-7-release"}
+	if _, err := runPayment(release); !errors.Is(err, payments.ErrDeclined) {
+		t.Errorf("release after capture = %v, want ErrDeclined", err)
+	}
+
+	charge := paymentOp{id: 4, kind: opCharge, accountID: &renter, amount: 1500, reference: "rental-7-late"}
+	if _, err := runPayment(charge); err != nil {
+		t.Errorf("charge: %v", err)
+	}
+	if _, err := runPayment(charge); err != nil {
+		t.Errorf("retried charge: %v", err)
+	}
+}
+
+func TestRunPaymentMalformed(t *testing.T) {
+	useFakeProvider(t)
+
+	for _, op := range []paymentOp{
+		{id: 1, kind: opCapture, amount: 100, reference: "rental-1-capture"},
+		{id: 2, kind: opPayout, amount: 100, reference: "rental-1-payout"},
+		{id: 3, kind: "refund", amount: 100, reference: "rental-1-refund"},
+	} {
+		if _, err := runPayment(op); !errors.Is(err, payments.ErrDeclined) {
+			t.Errorf("runPayment(%s without its account or payment) = %v, want ErrDeclined", op.kind, err)
+		}
+	}
+}
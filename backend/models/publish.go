@@ -0,0 +1,27 @@
+package models
+
+import "github.com/LuaanNguyen/backend/events"
+
+// Live updates for connected users. They are published after the commit, so nobody hears
+// about a change that was rolled back.
+
+// publishRentalStatus tells both parties that a rental moved to a new status
+func publishRentalStatus(rental Rental) {
+	events.Default.Publish(events.Event{Type: events.RentalStatus, Data: rental}, rental.OwnerID, rental.RenterID)
+}
+
+// publishRentalRequested tells an owner about a new request for one of their items
+func publishRentalRequested(ownerID int64, rental RentalRequest) {
+	events.Default.Publish(events.Event{Type: events.RentalRequested, Data: rental}, ownerID)
+}
+
+// publishRead gives the other participant a read receipt for their messages
+func publishRead(c Conversation, readerID, count int64) {
+	receipt := events.ReadReceipt{ConversationID: c.ID, ReaderID: readerID, Count: count}
+	events.Default.Publish(events.Event{Type: events.MessagesRead, Data: receipt}, c.OtherParticipant(readerID))
+}
+
+// publishMessage sends a new message to both participants, so the sender's other tabs see it too
+func publishMessage(c Conversation, m Message) {
+	events.Default.Publish(events.Event{Type: events.MessageCreated, Data: m}, c.OwnerID, c.RenterID)
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// ServiceFeePercent is the platform's cut, charged to the renter on top of the rental price
+const ServiceFeePercent = 10
+
+// QuoteLine is one row of a price breakdown, amounts are in cents like items.i_price
+type QuoteLine struct {
+	Label  string `json:"label"`
+	Amount int64  `json:"amount"`
+}
+
+type Quote struct {
+	ItemID     int64       `json:"item_id"`
+	StartDate  time.Time   `json:"start_date"`
+	EndDate    time.Time   `json:"end_date"`
+	Days       int         `json:"days"`
+	DailyRate  int64       `json:"daily_rate"`
+	Subtotal   int64       `json:"subtotal"`
+	ServiceFee int64       `json:"service_fee"`
+	Total      int64       `json:"total"`
+	Lines      []QuoteLine `json:"lines"`
+}
+
+// rentalDays counts started days, so 25 hours is billed as 2 days
+func rentalDays(start, end time.Time) int {
+	days := int(math.Ceil(end.Sub(start).Hours() / 24))
+	if days < 1 {
+		days = 1
+	}
+	return days
+}
+
+// CalculateQuote prices a rental of an item with the given daily rate
+func CalculateQuote(itemID int64, dailyRate int64, start, end time.Time) Quote {
+	days := rentalDays(start, end)
+	subtotal := dailyRate * int64(days)
+	// Round half up to the nearest cent
+	serviceFee := (subtotal*ServiceFeePercent + 50) / 100
+
+	return Quote{
+		ItemID:     itemID,
+		StartDate:  start,
+		EndDate:    end,
+		Days:       days,
+		DailyRate:  dailyRate,
+		Subtotal:   subtotal,
+		ServiceFee: serviceFee,
+		Total:      subtotal + serviceFee,
+		Lines: []QuoteLine{
+			{Label: fmt.Sprintf("Rental (%d day(s))", days), Amount: subtotal},
+			{Label: fmt.Sprintf("Service fee (%d%%)", ServiceFeePercent), Amount: serviceFee},
+		},
+	}
+}
+
+// -------------- Quote a rental of an item for the given dates --------------
+func QuoteRental(itemID int64, start, end time.Time) (Quote, error) {
+	if !start.Before(end) {
+		return Quote{}, ErrInvalidDates
+	}
+
+	var price int64
+	err := db.DB.QueryRow("SELECT i_price FROM items WHERE i_id = $1", itemID).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Quote{}, ErrNotFound
+	}
+	if err != nil {
+		return Quote{}, fmt.Errorf("error querying item price: %v", err)
+	}
+
+	return CalculateQuote(itemID, price, start, end), nil
+}
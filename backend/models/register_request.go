@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+type RegisterRequest struct {
+	Email       string  `json:"email"`
+	PhoneNumber string  `json:"phone_number"`
+	FirstName   string  `json:"first_name"`
+	LastName    string  `json:"last_name"`
+	NickName    *string `json:"nick_name,omitempty"`
+	Password    string  `json:"password"`
+}
+
+// Phone numbers are stored in a VARCHAR(15), e.g. "218-196-0013"
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 \-]{6,14}$`)
+
+const minPasswordLength = 8
+
+// Validate trims the request fields and checks them before a user is created
+func (r *RegisterRequest) Validate() error {
+	r.Email = strings.ToLower(strings.TrimSpace(r.Email))
+	r.PhoneNumber = strings.TrimSpace(r.PhoneNumber)
+	r.FirstName = strings.TrimSpace(r.FirstName)
+	r.LastName = strings.TrimSpace(r.LastName)
+
+	if addr, err := mail.ParseAddress(r.Email); err != nil || addr.Address != r.Email || len(r.Email) > 255 {
+		return errors.New("invalid email address")
+	}
+	if r.PhoneNumber != "" && (len(r.PhoneNumber) > 15 || !phonePattern.MatchString(r.PhoneNumber)) {
+		return errors.New("invalid phone number")
+	}
+	if r.FirstName == "" || len(r.FirstName) > 255 {
+		return errors.New("first name is required")
+	}
+	if r.LastName == "" || len(r.LastName) > 255 {
+		return errors.New("last name is required")
+	}
+	if r.NickName != nil {
+		nick := strings.TrimSpace(*r.NickName)
+		if nick == "" {
+			r.NickName = nil
+		} else if len(nick) > 255 {
+			return errors.New("nick name is too long")
+		} else {
+			r.NickName = &nick
+		}
+	}
+	if len(r.Password) < minPasswordLength {
+		return errors.New("password must be at least 8 characters")
+	}
+	// bcrypt ignores everything past 72 bytes
+	if len(r.Password) > 72 {
+		return errors.New("password must be at most 72 bytes")
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Rental statuses, matching the CHECK constraint on rentals.status
+const (
+	RentalPending   = "pending"
+	RentalApproved  = "approved"
+	RentalActive    = "active" // checked out, the renter has the item
+	RentalRejected  = "rejected"
+	RentalCompleted = "completed"
+	RentalCancelled = "cancelled"
+)
+
+// ErrIllegalTransition is returned when a rental can't move from its current status to the requested one
+var ErrIllegalTransition = errors.New("illegal rental status transition")
+
+// ErrHandoverRequired is returned when a status change needs both parties to confirm a handover
+var ErrHandoverRequired = errors.New("status change requires a checkout or checkin")
+
+// Deposit statuses, matching the CHECK constraint on rentals.deposit_status
+const (
+	DepositNone     = "none"     // the item asks for no deposit, or the rental isn't approved yet
+	DepositHeld     = "held"     // authorized on approval, waiting for the return
+	DepositReleased = "released" // given back in full
+	DepositClaimed  = "claimed"  // settled through a damage claim
+)
+
+// Which party of a rental is acting
+const (
+	PartyOwner  = "owner"
+	PartyRenter = "renter"
+)
+
+// rentalTransitions lists, per current status, the statuses it may move to and who may move it there
+var rentalTransitions = map[string]map[string][]string{
+	RentalPending: {
+		RentalApproved:  {PartyOwner},
+		RentalRejected:  {PartyOwner},
+		RentalCancelled: {PartyOwner, PartyRenter},
+	},
+	RentalApproved: {
+		RentalActive:    {PartyOwner, PartyRenter},
+		RentalCompleted: {PartyOwner}, // for handovers that weren't recorded
+		RentalCancelled: {PartyOwner, PartyRenter},
+	},
+	RentalActive: {
+		RentalCompleted: {PartyOwner, PartyRenter},
+	},
+	// rejected, completed and cancelled are final
+}
+
+// needsHandover reports whether a transition only happens through a handover report both
+// parties confirmed: checkout makes a rental active, checkin completes an active one
+func needsHandover(from, to string) bool {
+	return to == RentalActive || from == RentalActive
+}
+
+// ValidRentalStatus reports whether status is one of the rental statuses
+func ValidRentalStatus(status string) bool {
+	switch status {
+	case RentalPending, RentalApproved, RentalActive, RentalRejected, RentalCompleted, RentalCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether a rental in status from may move to status to
+func CanTransition(from, to string) bool {
+	_, ok := rentalTransitions[from][to]
+	return ok
+}
+
+// canActOn reports whether the given party may make the from -> to transition
+func canActOn(from, to, party string) bool {
+	for _, p := range rentalTransitions[from][to] {
+		if p == party {
+			return true
+		}
+	}
+	return false
+}
+
+type Rental struct {
+	ID                 int64      `json:"id"`
+	ItemID             int64      `json:"item_id"`
+	ItemName           string     `json:"item_name"`
+	OwnerID            int64      `json:"owner_id"`
+	RenterID           int64      `json:"renter_id"`
+	RenterName         string     `json:"renter_name"`
+	StartDate          time.Time  `json:"start_date"`
+	EndDate            time.Time  `json:"end_date"`
+	Status             string     `json:"status"`
+	TotalPrice         int64      `json:"total_price"`
+	ServiceFee         int64      `json:"service_fee"`          // part of TotalPrice kept by the platform
+	PaymentID          *string    `json:"payment_id,omitempty"` // provider payment, set on approval
+	Deposit            int64      `json:"deposit"`
+	DepositStatus      string     `json:"deposit_status"`
+	DepositPaymentID   *string    `json:"deposit_payment_id,omitempty"` // provider hold, set on approval
+	CancellationPolicy string     `json:"cancellation_policy"`
+	RefundAmount       *int64     `json:"refund_amount,omitempty"` // set when an approved rental is cancelled
+	LateFeePerDay      int64      `json:"late_fee_per_day"`
+	OverdueAt          *time.Time `json:"overdue_at,omitempty"` // set by the late return job
+	LateDays           int        `json:"late_days"`            // started days past end_date charged so far
+	CreatedAt          time.Time  `json:"created_at"`
+	StatusChangedBy    *int64     `json:"status_changed_by,omitempty"` // nullable
+	StatusChangedAt    *time.Time `json:"status_changed_at,omitempty"` // nullable
+}
+
+// PartyOf returns which side of the rental the user is on, or "" if neither
+func (r *Rental) PartyOf(userID int64) string {
+	switch userID {
+	case r.OwnerID:
+		return PartyOwner
+	case r.RenterID:
+		return PartyRenter
+	}
+	return ""
+}
@@ -0,0 +1,301 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// rentalSelect is shared by every query that returns a full Rental
+const rentalSelect = `
+	SELECT
+		r.rental_id,
+		r.item_id,
+		i.i_name,
+		i.owner_id,
+		r.renter_id,
+		u.u_first_name || ' ' || u.u_last_name AS renter_name,
+		r.start_date,
+		r.end_date,
+		r.status,
+		r.total_price,
+		r.service_fee,
+		r.payment_id,
+		r.deposit,
+		r.deposit_status,
+		r.deposit_payment_id,
+		r.cancellation_policy,
+		r.refund_amount,
+		r.late_fee_per_day,
+		r.overdue_at,
+		r.late_days,
+		r.created_at,
+		r.status_changed_by,
+		r.status_changed_at
+	FROM rentals r
+	JOIN items i ON r.item_id = i.i_id
+	JOIN users u ON r.renter_id = u.u_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRental(row rowScanner) (Rental, error) {
+	var r Rental
+	err := row.Scan(
+		&r.ID,
+		&r.ItemID,
+		&r.ItemName,
+		&r.OwnerID,
+		&r.RenterID,
+		&r.RenterName,
+		&r.StartDate,
+		&r.EndDate,
+		&r.Status,
+		&r.TotalPrice,
+		&r.ServiceFee,
+		&r.PaymentID,
+		&r.Deposit,
+		&r.DepositStatus,
+		&r.DepositPaymentID,
+		&r.CancellationPolicy,
+		&r.RefundAmount,
+		&r.LateFeePerDay,
+		&r.OverdueAt,
+		&r.LateDays,
+		&r.CreatedAt,
+		&r.StatusChangedBy,
+		&r.StatusChangedAt,
+	)
+	return r, err
+}
+
+// -------------- Get a single rental by its ID --------------
+func GetRental(id int64) (Rental, error) {
+	r, err := scanRental(db.DB.QueryRow(rentalSelect+" WHERE r.rental_id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return Rental{}, fmt.Errorf("error querying rental: %v", err)
+	}
+	return r, nil
+}
+
+// -------------- Get rental requests for items the user owns, optionally filtered by status --------------
+func GetIncomingRentals(ownerID int64, status string) ([]Rental, error) {
+	query := rentalSelect + " WHERE i.owner_id = $1"
+	args := []interface{}{ownerID}
+	if status != "" {
+		query += " AND r.status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY r.start_date DESC"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying incoming rentals: %v", err)
+	}
+	defer rows.Close()
+
+	var rentals []Rental
+	for rows.Next() {
+		r, err := scanRental(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning rental: %v", err)
+		}
+		rentals = append(rentals, r)
+	}
+	return rentals, nil
+}
+
+// -------------- Move a rental to a new status --------------
+// The rental row is locked for the duration so two concurrent requests
+// (e.g. approve and cancel) can't both succeed. Illegal transitions return
+// ErrIllegalTransition, and users who aren't the right party ErrForbidden.
+func TransitionRental(rentalID, actorID int64, to string) (Rental, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Rental{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rental{}, ErrNotFound
+	}
+	if err != nil {
+		return Rental{}, fmt.Errorf("error querying rental: %v", err)
+	}
+
+	party := rental.PartyOf(actorID)
+	if party == "" {
+		return Rental{}, ErrForbidden
+	}
+	if CanTransition(rental.Status, to) && needsHandover(rental.Status, to) {
+		return Rental{}, ErrHandoverRequired
+	}
+	if err := transitionLocked(tx, &rental, actorID, party, to); err != nil {
+		return Rental{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		if to == RentalApproved {
+			// Don't leave the renter with holds for an approval that never happened
+			releaseHolds(rental)
+		}
+		return Rental{}, fmt.Errorf("error committing rental status: %v", err)
+	}
+	settlePayments(rental.ID)
+	publishRentalStatus(rental)
+	return rental, nil
+}
+
+// transitionLocked moves a rental the caller has locked FOR UPDATE to a new status, recording
+// the change and settling its money inside the caller's transaction
+func transitionLocked(tx *sql.Tx, rental *Rental, actorID int64, party, to string) error {
+	from := rental.Status
+	if !CanTransition(from, to) {
+		return ErrIllegalTransition
+	}
+	if !canActOn(from, to, party) {
+		return ErrForbidden
+	}
+
+	// Re-check at approval time, other requests for the same dates may have been approved meanwhile
+	if to == RentalApproved {
+		if err := checkAvailability(tx, rental.ItemID, rental.StartDate, rental.EndDate, rental.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := recordStatus(tx, rental, actorID, to); err != nil {
+		return err
+	}
+	if err := notifyStatus(tx, *rental, party); err != nil {
+		return err
+	}
+
+	// Money moves last so every check above has passed before the provider is called
+	return settleRental(tx, rental, party, from, to)
+}
+
+// recordStatus saves a locked rental's new status and adds it to the status history
+func recordStatus(tx *sql.Tx, rental *Rental, actorID int64, to string) error {
+	from := rental.Status
+	err := tx.QueryRow(`
+		UPDATE rentals
+		SET status = $1, status_changed_by = $2, status_changed_at = CURRENT_TIMESTAMP
+		WHERE rental_id = $3
+		RETURNING status, status_changed_by, status_changed_at`, to, actorID, rental.ID).
+		Scan(&rental.Status, &rental.StatusChangedBy, &rental.StatusChangedAt)
+	if err != nil {
+		return fmt.Errorf("error updating rental status: %v", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO rental_status_history (rental_id, from_status, to_status, changed_by)
+		VALUES ($1, $2, $3, $4)`, rental.ID, from, to, actorID); err != nil {
+		return fmt.Errorf("error recording rental status: %v", err)
+	}
+	return nil
+}
+
+// -------------- Check that one more booking of the item fits in [start, end) --------------
+// Locks the item row, so callers must be inside a transaction and keep it open
+// until their insert/update is done. excludeRentalID skips the rental being approved.
+func checkAvailability(tx *sql.Tx, itemID int64, start, end time.Time, excludeRentalID int64) error {
+	var quantity int
+	err := tx.QueryRow("SELECT i_quantity FROM items WHERE i_id = $1 FOR UPDATE", itemID).Scan(&quantity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error locking item: %v", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT start_date, end_date
+		FROM rentals
+		WHERE item_id = $1
+		AND status IN ($2, $6)
+		AND rental_id <> $3
+		AND start_date < $5
+		AND end_date > $4`, itemID, RentalApproved, excludeRentalID, start, end, RentalActive)
+	if err != nil {
+		return fmt.Errorf("error querying overlapping rentals: %v", err)
+	}
+	defer rows.Close()
+
+	var bookings []dateRange
+	for rows.Next() {
+		b := dateRange{Units: 1}
+		if err := rows.Scan(&b.Start, &b.End); err != nil {
+			return fmt.Errorf("error scanning rental: %v", err)
+		}
+		bookings = append(bookings, b)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error scanning rentals: %v", err)
+	}
+
+	// A blackout takes every unit of the item out
+	blackouts, err := tx.Query(`
+		SELECT start_date, end_date
+		FROM item_blackouts
+		WHERE i_id = $1
+		AND start_date < $3
+		AND end_date > $2`, itemID, start, end)
+	if err != nil {
+		return fmt.Errorf("error querying blackouts: %v", err)
+	}
+	defer blackouts.Close()
+
+	for blackouts.Next() {
+		b := dateRange{Units: quantity}
+		if err := blackouts.Scan(&b.Start, &b.End); err != nil {
+			return fmt.Errorf("error scanning blackout: %v", err)
+		}
+		bookings = append(bookings, b)
+	}
+	if err := blackouts.Err(); err != nil {
+		return fmt.Errorf("error scanning blackouts: %v", err)
+	}
+
+	if conflict := findOverbooking(bookings, start, end, quantity); conflict != nil {
+		return conflict
+	}
+	return nil
+}
+
+// statusTitles word a rental's new status for the party who didn't make the change
+var statusTitles = map[string]string{
+	RentalApproved:  "Your request for %s was approved",
+	RentalRejected:  "Your request for %s was declined",
+	RentalCancelled: "The rental of %s was cancelled",
+	RentalActive:    "The rental of %s has started",
+	RentalCompleted: "The rental of %s is complete",
+}
+
+// notifyStatus tells the other party that the rental moved to its current status
+func notifyStatus(tx *sql.Tx, rental Rental, actorParty string) error {
+	title, ok := statusTitles[rental.Status]
+	if !ok {
+		return nil
+	}
+	recipient := rental.OwnerID
+	if actorParty == PartyOwner {
+		recipient = rental.RenterID
+	}
+	return notify(tx, Notification{
+		UserID:   recipient,
+		Kind:     NotifyRentalStatus,
+		Title:    fmt.Sprintf(title, rental.ItemName),
+		Body:     fmt.Sprintf("%s to %s.", rental.StartDate.Format("Jan 2, 15:04"), rental.EndDate.Format("Jan 2, 15:04")),
+		RentalID: &rental.ID,
+	})
+}
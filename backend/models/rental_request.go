@@ -9,5 +9,5 @@ type RentalRequest struct {
     StartDate   time.Time `json:"start_date"`
     EndDate     time.Time `json:"end_date"`
     Status      string    `json:"status"`
-    TotalPrice  int64     `json:"total_price"`
+    TotalPrice  int64     `json:"total_price"` // always computed server side, see CalculateQuote
 }
\ No newline at end of file
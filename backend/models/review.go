@@ -1,8 +1,61 @@
 package models
 
+import "time"
+
+// Review directions
+const (
+    RenterToOwner = "renter_to_owner"
+    OwnerToRenter = "owner_to_renter"
+)
+
+// ReviewWindow is how long both parties have to review after a rental completes.
+// A lone review is published when it closes.
+const ReviewWindow = 14 * 24 * time.Hour
+
 type Review struct {
-    ID      int64  `json:"id" db:"r_id"`
-    Comment string `json:"comment" db:"r_comment"`
-    Star    int    `json:"star" db:"r_star"`
-    UserID  int64  `json:"user_id" db:"u_id"`
+    ID            int64     `json:"id" db:"r_id"`
+    Comment       string    `json:"comment" db:"r_comment"`
+    Star          int       `json:"star" db:"r_star"`
+    UserID        int64     `json:"user_id" db:"u_id"` // the reviewer
+    ReviewerName  string    `json:"reviewer_name"`
+    RevieweeID    *int64    `json:"reviewee_id,omitempty" db:"reviewee_id"` // nullable for seeded reviews
+    RentalID      *int64    `json:"rental_id,omitempty" db:"rental_id"`     // nullable for seeded reviews
+    ItemID        *int64    `json:"item_id,omitempty" db:"i_id"`            // nullable
+    Direction     *string   `json:"direction,omitempty" db:"r_direction"`   // nullable for seeded reviews
+    ItemStar      *int      `json:"item_star,omitempty" db:"item_star"`           // renter -> owner only
+    ConditionStar *int      `json:"condition_star,omitempty" db:"condition_star"` // owner -> renter only
+    OnTime        *bool     `json:"on_time,omitempty" db:"on_time"`               // owner -> renter only
+    Published     bool      `json:"published"`
+    CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// Parse the request body of a new review. Renters may add item_star,
+// owners condition_star and on_time.
+type ReviewRequest struct {
+    Star          int    `json:"star"`
+    Comment       string `json:"comment"`
+    ItemStar      *int   `json:"item_star,omitempty"`
+    ConditionStar *int   `json:"condition_star,omitempty"`
+    OnTime        *bool  `json:"on_time,omitempty"`
+}
+
+// RatingSummary is an average star rating over Count reviews
+type RatingSummary struct {
+    Average float64 `json:"average"`
+    Count   int     `json:"count"`
+}
+
+// Reputation aggregates the published reviews a user received on each side of the marketplace
+type Reputation struct {
+    AsOwner        RatingSummary `json:"as_owner"`
+    AsRenter       RatingSummary `json:"as_renter"`
+    ItemRating     RatingSummary `json:"item_rating"`          // renters' ratings of this user's items
+    ConditionScore RatingSummary `json:"condition_score"`      // owners' ratings of how items came back
+    OnTimeRate     *float64      `json:"on_time_rate,omitempty"` // share of returns marked on time, nil if none rated
+}
+
+// UserProfile is what GET /api/user/{id} returns
+type UserProfile struct {
+    User
+    Reputation Reputation `json:"reputation"`
 }
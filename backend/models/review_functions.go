@@ -0,0 +1,228 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+	"github.com/lib/pq"
+)
+
+// ErrAlreadyReviewed is returned when a party reviews the same rental twice
+var ErrAlreadyReviewed = errors.New("rental already reviewed")
+
+// ErrRentalNotCompleted is returned when reviewing a rental that hasn't been completed
+var ErrRentalNotCompleted = errors.New("rental is not completed")
+
+// ErrInvalidReview is returned for stars outside 1-5 or ratings meant for the other direction
+var ErrInvalidReview = errors.New("invalid review")
+
+// ErrReviewWindowClosed is returned when reviewing a rental completed more than ReviewWindow ago
+var ErrReviewWindowClosed = errors.New("review window has closed")
+
+// visibleReview hides a review until both parties reviewed or the window closed
+const visibleReview = "(rv.published_at IS NOT NULL OR rv.reveal_at IS NULL OR rv.reveal_at <= CURRENT_TIMESTAMP)"
+
+const reviewSelect = `
+	SELECT
+		rv.r_id,
+		rv.r_comment,
+		rv.r_star,
+		rv.u_id,
+		u.u_first_name || ' ' || u.u_last_name AS reviewer_name,
+		rv.reviewee_id,
+		rv.rental_id,
+		rv.i_id,
+		rv.r_direction,
+		rv.item_star,
+		rv.condition_star,
+		rv.on_time,
+		` + visibleReview + `,
+		rv.created_at
+	FROM reviews rv
+	JOIN users u ON rv.u_id = u.u_id`
+
+func scanReview(row rowScanner) (Review, error) {
+	var rv Review
+	err := row.Scan(&rv.ID, &rv.Comment, &rv.Star, &rv.UserID, &rv.ReviewerName,
+		&rv.RevieweeID, &rv.RentalID, &rv.ItemID, &rv.Direction, &rv.ItemStar,
+		&rv.ConditionStar, &rv.OnTime, &rv.Published, &rv.CreatedAt)
+	return rv, err
+}
+
+func queryReviews(query string, args ...interface{}) ([]Review, error) {
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reviews: %v", err)
+	}
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning review: %v", err)
+		}
+		reviews = append(reviews, rv)
+	}
+	return reviews, nil
+}
+
+// validStar reports whether an optional star rating is absent or within 1-5
+func validStar(star *int) bool {
+	return star == nil || (*star >= 1 && *star <= 5)
+}
+
+// -------------- Review the other party of a completed rental --------------
+// Reviews are double-blind: each stays hidden until the other party has
+// reviewed too, or until ReviewWindow after completion, so neither side can
+// retaliate against what the other wrote.
+func CreateRentalReview(rentalID, reviewerID int64, req ReviewRequest) (Review, error) {
+	if req.Star < 1 || req.Star > 5 || !validStar(req.ItemStar) || !validStar(req.ConditionStar) {
+		return Review{}, ErrInvalidReview
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return Review{}, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the rental so both parties submitting at once can't both miss each other's review
+	rental, err := scanRental(tx.QueryRow(rentalSelect+" WHERE r.rental_id = $1 FOR UPDATE OF r", rentalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Review{}, ErrNotFound
+	}
+	if err != nil {
+		return Review{}, fmt.Errorf("error querying rental: %v", err)
+	}
+
+	party := rental.PartyOf(reviewerID)
+	if party == "" {
+		return Review{}, ErrForbidden
+	}
+	if rental.Status != RentalCompleted {
+		return Review{}, ErrRentalNotCompleted
+	}
+
+	completedAt := time.Now()
+	if rental.StatusChangedAt != nil {
+		completedAt = *rental.StatusChangedAt
+	}
+	revealAt := completedAt.Add(ReviewWindow)
+	if time.Now().After(revealAt) {
+		return Review{}, ErrReviewWindowClosed
+	}
+
+	revieweeID, direction := rental.OwnerID, RenterToOwner
+	if party == PartyOwner {
+		revieweeID, direction = rental.RenterID, OwnerToRenter
+		if req.ItemStar != nil {
+			return Review{}, ErrInvalidReview
+		}
+	} else if req.ConditionStar != nil || req.OnTime != nil {
+		return Review{}, ErrInvalidReview
+	}
+
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO reviews (r_comment, r_star, u_id, reviewee_id, rental_id, i_id,
+			r_direction, item_star, condition_star, on_time, reveal_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING r_id`, req.Comment, req.Star, reviewerID, revieweeID, rental.ID, rental.ItemID,
+		direction, req.ItemStar, req.ConditionStar, req.OnTime, revealAt).Scan(&id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return Review{}, ErrAlreadyReviewed
+		}
+		return Review{}, fmt.Errorf("error creating review: %v", err)
+	}
+
+	// Second review in: publish both
+	var reviewCount int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM reviews WHERE rental_id = $1", rental.ID).Scan(&reviewCount); err != nil {
+		return Review{}, fmt.Errorf("error counting reviews: %v", err)
+	}
+	if reviewCount == 2 {
+		if _, err := tx.Exec(`
+			UPDATE reviews SET published_at = CURRENT_TIMESTAMP
+			WHERE rental_id = $1 AND published_at IS NULL`, rental.ID); err != nil {
+			return Review{}, fmt.Errorf("error publishing reviews: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Review{}, fmt.Errorf("error committing review: %v", err)
+	}
+
+	return GetReview(id)
+}
+
+// -------------- Get a review by its ID --------------
+func GetReview(id int64) (Review, error) {
+	rv, err := scanReview(db.DB.QueryRow(reviewSelect+" WHERE rv.r_id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Review{}, ErrNotFound
+	}
+	if err != nil {
+		return Review{}, fmt.Errorf("error querying review: %v", err)
+	}
+	return rv, nil
+}
+
+// -------------- Get published reviews of an item, newest first --------------
+// Only renters review items, so owners' reviews of renters are left out.
+func GetItemReviews(itemID int64) ([]Review, error) {
+	return queryReviews(reviewSelect+`
+		WHERE rv.i_id = $1
+		AND (rv.r_direction IS NULL OR rv.r_direction = $2)
+		AND `+visibleReview+`
+		ORDER BY rv.r_id DESC`, itemID, RenterToOwner)
+}
+
+// -------------- Get published reviews a user received, newest first --------------
+// direction optionally narrows to reviews received as owner or as renter.
+func GetUserReviews(userID int64, direction string) ([]Review, error) {
+	query := reviewSelect + " WHERE rv.reviewee_id = $1 AND " + visibleReview
+	args := []interface{}{userID}
+	if direction != "" {
+		query += " AND rv.r_direction = $2"
+		args = append(args, direction)
+	}
+	return queryReviews(query+" ORDER BY rv.r_id DESC", args...)
+}
+
+// -------------- Aggregate a user's published reviews into reputation scores --------------
+func GetUserReputation(userID int64) (Reputation, error) {
+	var rep Reputation
+	var onTimeRate sql.NullFloat64
+	err := db.DB.QueryRow(`
+		SELECT
+			COALESCE(AVG(rv.r_star) FILTER (WHERE rv.r_direction = $2), 0),
+			COUNT(*) FILTER (WHERE rv.r_direction = $2),
+			COALESCE(AVG(rv.r_star) FILTER (WHERE rv.r_direction = $3), 0),
+			COUNT(*) FILTER (WHERE rv.r_direction = $3),
+			COALESCE(AVG(rv.item_star) FILTER (WHERE rv.r_direction = $2), 0),
+			COUNT(rv.item_star) FILTER (WHERE rv.r_direction = $2),
+			COALESCE(AVG(rv.condition_star) FILTER (WHERE rv.r_direction = $3), 0),
+			COUNT(rv.condition_star) FILTER (WHERE rv.r_direction = $3),
+			AVG(CASE WHEN rv.on_time THEN 1.0 ELSE 0.0 END) FILTER (WHERE rv.r_direction = $3 AND rv.on_time IS NOT NULL)
+		FROM reviews rv
+		WHERE rv.reviewee_id = $1 AND `+visibleReview, userID, RenterToOwner, OwnerToRenter).Scan(
+		&rep.AsOwner.Average, &rep.AsOwner.Count,
+		&rep.AsRenter.Average, &rep.AsRenter.Count,
+		&rep.ItemRating.Average, &rep.ItemRating.Count,
+		&rep.ConditionScore.Average, &rep.ConditionScore.Count,
+		&onTimeRate,
+	)
+	if err != nil {
+		return Reputation{}, fmt.Errorf("error querying reputation: %v", err)
+	}
+	if onTimeRate.Valid {
+		rep.OnTimeRate = &onTimeRate.Float64
+	}
+	return rep, nil
+}
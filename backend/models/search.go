@@ -1,9 +1,57 @@
 package models
 
+import "fmt"
+
+// Sort keys accepted by item listings
+const (
+	SortNewest    = "newest"
+	SortRating    = "rating"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+)
+
+// ListOptions narrows and orders item listings by their reviews
+type ListOptions struct {
+	MinRating *float64 `json:"min_rating"` // Optional minimum average star rating
+	Sort      string   `json:"sort"`       // One of the Sort* keys, newest if empty
+}
+
 type SearchParams struct {
 	Query      string `json:"query"`       // For name/description search
 	CategoryID *int   `json:"category_id"` // Optional category filter
 	MinPrice   *int   `json:"min_price"`   // Optional minimum price
 	MaxPrice   *int   `json:"max_price"`   // Optional maximum price
 	Available  *bool  `json:"available"`   // Optional availability filter
-}
\ No newline at end of file
+	ListOptions
+}
+
+// ValidSort reports whether sort is empty or one of the Sort* keys
+func ValidSort(sort string) bool {
+	_, ok := orderBy[sort]
+	return ok || sort == ""
+}
+
+// orderBy maps sort keys to ORDER BY clauses. Queries alias items as i and item_rating_stats as irs.
+var orderBy = map[string]string{
+	SortNewest:    "i.i_date_listed DESC",
+	SortRating:    "COALESCE(irs.rating, 0) DESC, COALESCE(irs.review_count, 0) DESC, i.i_date_listed DESC",
+	SortPriceAsc:  "i.i_price ASC, i.i_date_listed DESC",
+	SortPriceDesc: "i.i_price DESC, i.i_date_listed DESC",
+}
+
+// orderClause returns the ORDER BY clause for the options, newest first by default
+func (o ListOptions) orderClause() string {
+	if clause, ok := orderBy[o.Sort]; ok {
+		return " ORDER BY " + clause
+	}
+	return " ORDER BY " + orderBy[SortNewest]
+}
+
+// ratingClause adds the min_rating filter as the next positional argument
+func (o ListOptions) ratingClause(args []interface{}) (string, []interface{}) {
+	if o.MinRating == nil {
+		return "", args
+	}
+	args = append(args, *o.MinRating)
+	return fmt.Sprintf(" AND COALESCE(irs.rating, 0) >= $%d", len(args)), args
+}
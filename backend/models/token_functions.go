@@ -0,0 +1,145 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// ErrRefreshTokenInvalid is returned for unknown, expired or already used refresh tokens
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+
+// ReuseGracePeriod is how long after a rotation the old token is only rejected rather than
+// treated as stolen, so two tabs refreshing with the same token at once don't log out
+const ReuseGracePeriod = 10 * time.Second
+
+// -------------- Store a new refresh token hash for a user --------------
+// Each call starts a new token family, see RotateRefreshToken.
+func CreateRefreshToken(userID int64, tokenHash string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO refresh_tokens (u_id, rt_hash, rt_expires_at)
+		VALUES ($1, $2, $3)`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating refresh token: %v", err)
+	}
+	return nil
+}
+
+// -------------- Swap a refresh token for a new one in a single transaction --------------
+// The new token joins the old one's family. Presenting a token that was
+// already rotated means it leaked, so the whole family is revoked and that
+// session has to log in again; the user's other sessions keep working.
+// A token that was ended by logout, or rotated within ReuseGracePeriod, is
+// only rejected.
+func RotateRefreshToken(oldHash, newHash string, expiresAt time.Time) (int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var userID, family int64
+	err = tx.QueryRow(`
+		UPDATE refresh_tokens
+		SET rt_revoked_at = CURRENT_TIMESTAMP, rt_revoked_reason = 'rotated'
+		WHERE rt_hash = $1 AND rt_revoked_at IS NULL AND rt_expires_at > CURRENT_TIMESTAMP
+		RETURNING u_id, rt_family`, oldHash).Scan(&userID, &family)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either unknown, expired, logged out or reused; on reuse burn the token's family
+		if err := revokeOnReuse(tx, oldHash); err != nil {
+			return 0, err
+		}
+		return 0, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error rotating refresh token: %v", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO refresh_tokens (u_id, rt_hash, rt_expires_at, rt_family)
+		VALUES ($1, $2, $3, $4)`, userID, newHash, expiresAt, family); err != nil {
+		return 0, fmt.Errorf("error creating refresh token: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing refresh token: %v", err)
+	}
+	return userID, nil
+}
+
+// revokeOnReuse revokes the token's family if the presented one was rotated more than
+// ReuseGracePeriod ago, and commits that
+func revokeOnReuse(tx *sql.Tx, tokenHash string) error {
+	var family int64
+	var reason sql.NullString
+	var recent bool
+	err := tx.QueryRow(`
+		SELECT rt_family, rt_revoked_reason,
+			COALESCE(rt_revoked_at > CURRENT_TIMESTAMP - make_interval(secs => $2), FALSE)
+		FROM refresh_tokens
+		WHERE rt_hash = $1 FOR UPDATE`, tokenHash, ReuseGracePeriod.Seconds()).Scan(&family, &reason, &recent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error querying refresh token: %v", err)
+	}
+	if reason.String != "rotated" {
+		return nil
+	}
+	// A concurrent refresh that lost the race, not a stolen token
+	if recent {
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE refresh_tokens SET rt_revoked_at = CURRENT_TIMESTAMP, rt_revoked_reason = 'reuse'
+		WHERE rt_family = $1 AND rt_revoked_at IS NULL`, family); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing refresh token revocation: %v", err)
+	}
+	return nil
+}
+
+// -------------- Revoke a single refresh token belonging to a user --------------
+func RevokeRefreshToken(userID int64, tokenHash string) error {
+	_, err := db.DB.Exec(`
+		UPDATE refresh_tokens SET rt_revoked_at = CURRENT_TIMESTAMP, rt_revoked_reason = 'logout'
+		WHERE u_id = $1 AND rt_hash = $2 AND rt_revoked_at IS NULL`, userID, tokenHash)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh token: %v", err)
+	}
+	return nil
+}
+
+// -------------- Revoke an access token by its jti until it would have expired --------------
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO revoked_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error revoking token: %v", err)
+	}
+
+	// Expired entries can never match a valid token again, keep the table small
+	if _, err := db.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+		return fmt.Errorf("error pruning revoked tokens: %v", err)
+	}
+	return nil
+}
+
+// -------------- Check whether an access token was revoked --------------
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("error checking revoked token: %v", err)
+	}
+	return revoked, nil
+}
@@ -2,11 +2,26 @@ package models
 
 import "time"
 
+// Transaction types. Purchase, Sale and Rental predate the ledger and are no longer written.
+const (
+    TxCharge = "Charge" // renter pays the rental total when the owner approves
+    TxPayout = "Payout" // owner receives the total minus the service fee on completion
+    TxFee    = "Fee"    // platform keeps the service fee on completion, has no user
+    TxRefund = "Refund" // renter gets money back after a cancellation
+
+    TxDepositHold    = "DepositHold"    // renter's deposit is authorized on approval
+    TxDepositRelease = "DepositRelease" // deposit, or what a claim left of it, goes back to the renter
+    TxDepositCapture = "DepositCapture" // part of the deposit is taken for a damage claim
+    TxLateFee        = "LateFee"        // renter owes a late fee for a started day past end_date
+)
+
 type Transaction struct {
     ID        int64     `json:"id" db:"t_id"`
     UserID    int64     `json:"user_id" db:"u_id"`
-    Type      string    `json:"type" db:"t_type"` // ENUM: 'Purchase', 'Sale', etc.
+    Type      string    `json:"type" db:"t_type"` // ENUM: 'Charge', 'Payout', 'Fee', 'Refund', ...
     ItemID    int64     `json:"item_id" db:"i_id"`
+    RentalID  *int64    `json:"rental_id,omitempty" db:"rental_id"` // nullable
     Date      time.Time `json:"date" db:"t_date"`
-    Amount    int       `json:"amount" db:"t_amount"`
+    Amount    int       `json:"amount" db:"t_amount"` // cents, always positive
+    Reference *string   `json:"reference,omitempty" db:"t_reference"` // provider payment or payout ID
 }
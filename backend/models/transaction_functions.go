@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+const transactionSelect = `
+	SELECT t_id, u_id, t_type, i_id, rental_id, t_date, t_amount, t_reference
+	FROM transactions`
+
+func scanTransaction(row rowScanner) (Transaction, error) {
+	var t Transaction
+	err := row.Scan(&t.ID, &t.UserID, &t.Type, &t.ItemID, &t.RentalID, &t.Date, &t.Amount, &t.Reference)
+	return t, err
+}
+
+// postTransaction writes one ledger entry. A nil userID books the entry to the platform.
+func postTransaction(tx *sql.Tx, userID *int64, txType string, rental Rental, amount int64, reference *string) error {
+	if amount <= 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO transactions (u_id, t_type, i_id, rental_id, t_amount, t_reference)
+		VALUES ($1, $2, $3, $4, $5, $6)`, userID, txType, rental.ItemID, rental.ID, amount, reference)
+	if err != nil {
+		return fmt.Errorf("error posting %s transaction: %v", txType, err)
+	}
+	return nil
+}
+
+// -------------- Get the ledger entries of a user, newest first --------------
+func GetUserTransactions(userID int64) ([]Transaction, error) {
+	rows, err := db.DB.Query(transactionSelect+" WHERE u_id = $1 ORDER BY t_date DESC, t_id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying transactions: %v", err)
+	}
+	defer rows.Close()
+
+	transactions := []Transaction{}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning transaction: %v", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// -------------- Get one of a user's ledger entries --------------
+func GetUserTransaction(id, userID int64) (Transaction, error) {
+	// Other users' entries look missing rather than forbidden
+	t, err := scanTransaction(db.DB.QueryRow(transactionSelect+" WHERE t_id = $1 AND u_id = $2", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Transaction{}, ErrNotFound
+	}
+	if err != nil {
+		return Transaction{}, fmt.Errorf("error querying transaction: %v", err)
+	}
+	return t, nil
+}
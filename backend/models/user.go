@@ -1,11 +1,36 @@
 package models
 
+// User roles, stored in users.u_role and carried in the JWT claims
+const (
+    RoleUser      = "user"
+    RoleModerator = "moderator"
+    RoleAdmin     = "admin"
+)
+
 type User struct {
     ID          int64  `json:"id" db:"u_id"`
-    Email       string `json:"email" db:"u_email"`
-    PhoneNumber string `json:"phone_number" db:"u_phone_number"`
+    Email       string `json:"email,omitempty" db:"u_email"`               // left out of public profiles
+    PhoneNumber string `json:"phone_number,omitempty" db:"u_phone_number"` // left out of public profiles
     FirstName   string `json:"first_name" db:"u_first_name"`
     LastName    string `json:"last_name" db:"u_last_name"`
     NickName    *string `json:"nick_name,omitempty" db:"u_nick_name"` // nullable
+    Role        string `json:"role" db:"u_role"`
     Password    string `json:"-" db:"u_password"` // hide in JSON responses
 }
+
+// Public returns the user without their contact details, for everyone but themselves and staff
+func (u User) Public() User {
+    u.Email = ""
+    u.PhoneNumber = ""
+    return u
+}
+
+// Parse the request body of a role change
+type RoleRequest struct {
+    Role string `json:"role"`
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+    return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
@@ -0,0 +1,21 @@
+package notifications
+
+import "github.com/LuaanNguyen/backend/events"
+
+// InAppChannel pushes notifications to the user's open event streams. The inbox row itself is
+// written with the notification, so users who aren't connected see it on their next fetch.
+type InAppChannel struct{}
+
+func NewInAppChannel() *InAppChannel {
+	return &InAppChannel{}
+}
+
+func (c *InAppChannel) Name() string {
+	return "inapp"
+}
+
+func (c *InAppChannel) Send(m Message) error {
+	m.Email = ""
+	events.Default.Publish(events.Event{Type: events.NotificationCreated, Data: m}, m.UserID)
+	return nil
+}
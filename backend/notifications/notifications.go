@@ -0,0 +1,85 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrUndeliverable is returned for a message a channel can never deliver (e.g. no address),
+// so it is given up on instead of retried
+var ErrUndeliverable = errors.New("notification undeliverable")
+
+// Message is a notification on its way to one user
+type Message struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	RentalID  *int64    `json:"rental_id,omitempty"` // nullable
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Channel delivers notifications one way, e.g. by email. Send may be retried after an
+// error, so a message can arrive more than once.
+type Channel interface {
+	// Name is stored with each delivery in the outbox, so it must stay stable
+	Name() string
+	Send(m Message) error
+}
+
+// Channels are the configured delivery channels, set up by InitChannels
+var Channels []Channel
+
+// InitChannels picks the channels from NOTIFY_CHANNELS, a comma separated list of
+// "inapp" (the default), "email" and "webhook"
+func InitChannels() error {
+	value := os.Getenv("NOTIFY_CHANNELS")
+	if value == "" {
+		value = "inapp"
+	}
+
+	Channels = nil
+	for _, name := range strings.Split(value, ",") {
+		var channel Channel
+		var err error
+		switch name = strings.TrimSpace(name); name {
+		case "inapp":
+			channel = NewInAppChannel()
+		case "email":
+			channel, err = NewSMTPChannelFromEnv()
+		case "webhook":
+			channel, err = NewWebhookChannelFromEnv()
+		default:
+			return fmt.Errorf("unknown notification channel %q", name)
+		}
+		if err != nil {
+			return err
+		}
+		Channels = append(Channels, channel)
+	}
+	return nil
+}
+
+// ChannelNames lists the configured channels' names
+func ChannelNames() []string {
+	names := make([]string, len(Channels))
+	for i, channel := range Channels {
+		names[i] = channel.Name()
+	}
+	return names
+}
+
+// Lookup returns the configured channel with the given name, nil if there is none
+func Lookup(name string) Channel {
+	for _, channel := range Channels {
+		if channel.Name() == name {
+			return channel
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package notifications
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// smtpTimeout bounds connecting to the server and the whole conversation with it, so a server
+// that stops answering can't hold up the dispatcher
+const smtpTimeout = 30 * time.Second
+
+// SMTPChannel emails notifications to the user's address
+type SMTPChannel struct {
+	addr string // host:port
+	host string
+	from string
+	auth smtp.Auth // nil to send without authentication
+}
+
+// NewSMTPChannelFromEnv reads SMTP_ADDR and SMTP_FROM, and SMTP_USERNAME and SMTP_PASSWORD
+// if the server needs them
+func NewSMTPChannelFromEnv() (*SMTPChannel, error) {
+	addr, from := os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_FROM")
+	if addr == "" || from == "" {
+		return nil, fmt.Errorf("the email channel needs SMTP_ADDR and SMTP_FROM")
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_ADDR %q: %v", addr, err)
+	}
+
+	c := &SMTPChannel{addr: addr, host: host, from: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		c.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return c, nil
+}
+
+func (c *SMTPChannel) Name() string {
+	return "email"
+}
+
+func (c *SMTPChannel) Send(m Message) error {
+	if m.Email == "" {
+		return fmt.Errorf("user %d has no email address: %w", m.UserID, ErrUndeliverable)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", c.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", m.CreatedAt.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := c.send(m.Email, []byte(msg.String())); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does, with a deadline on the connection. STARTTLS is used
+// whenever the server offers it.
+func (c *SMTPChannel) send(to string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", c.addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+			return err
+		}
+	}
+	if c.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+		if err := client.Auth(c.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(c.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,115 @@
+package notifications
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LuaanNguyen/backend/notifications/smtptest"
+)
+
+func newTestSMTPChannel(t *testing.T, server *smtptest.Server) *SMTPChannel {
+	t.Helper()
+	t.Setenv("SMTP_ADDR", server.Addr)
+	t.Setenv("SMTP_FROM", "noreply@example.com")
+	t.Setenv("SMTP_USERNAME", "")
+	c, err := NewSMTPChannelFromEnv()
+	if err != nil {
+		t.Fatalf("NewSMTPChannelFromEnv: %v", err)
+	}
+	return c
+}
+
+func TestSMTPChannelSend(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	c := newTestSMTPChannel(t, server)
+
+	err := c.Send(Message{
+		ID:        7,
+		UserID:    2,
+		Email:     "renter@example.com",
+		Kind:      "rental_status",
+		Title:     "Your rental was approved",
+		Body:      "Pick it up on Friday.\nBring an ID.",
+		CreatedAt: time.Date(2026, 3, 8, 9, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(messages))
+	}
+	m := messages[0]
+	if m.From != "noreply@example.com" {
+		t.Errorf("MAIL FROM = %q, want noreply@example.com", m.From)
+	}
+	if len(m.To) != 1 || m.To[0] != "renter@example.com" {
+		t.Errorf("RCPT TO = %q, want [renter@example.com]", m.To)
+	}
+	for _, want := range []string{
+		"To: renter@example.com\n",
+		"Subject: Your rental was approved\n",
+		"Date: Sun, 08 Mar 2026 09:30:00 +0000\n",
+		"\nPick it up on Friday.\nBring an ID.\n",
+	} {
+		if !strings.Contains(m.Data, want) {
+			t.Errorf("message is missing %q:\n%s", want, m.Data)
+		}
+	}
+}
+
+func TestSMTPChannelSendEncodesSubject(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	c := newTestSMTPChannel(t, server)
+
+	if err := c.Send(Message{UserID: 2, Email: "renter@example.com", Title: "Café pickup"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if data := server.Messages()[0].Data; !strings.Contains(data, "Subject: =?utf-8?q?Caf=C3=A9_pickup?=\n") {
+		t.Errorf("subject isn't Q-encoded:\n%s", data)
+	}
+}
+
+func TestSMTPChannelSendWithoutAddress(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	c := newTestSMTPChannel(t, server)
+
+	err := c.Send(Message{UserID: 2, Title: "Your rental was approved"})
+	if !errors.Is(err, ErrUndeliverable) {
+		t.Errorf("Send without an address = %v, want ErrUndeliverable", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Errorf("server got %d messages, want 0", n)
+	}
+}
+
+func TestSMTPChannelSendRejected(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+	server.RejectRecipients()
+	c := newTestSMTPChannel(t, server)
+
+	err := c.Send(Message{UserID: 2, Email: "gone@example.com", Title: "Your rental was approved"})
+	if err == nil {
+		t.Fatal("Send to a rejected recipient succeeded")
+	}
+	if errors.Is(err, ErrUndeliverable) {
+		t.Errorf("a server error should be retried, got %v", err)
+	}
+}
+
+func TestSMTPChannelSendServerDown(t *testing.T) {
+	server := smtptest.NewServer()
+	c := newTestSMTPChannel(t, server)
+	server.Close()
+
+	if err := c.Send(Message{UserID: 2, Email: "renter@example.com", Title: "Your rental was approved"}); err == nil {
+		t.Fatal("Send to a closed server succeeded")
+	}
+}
@@ -0,0 +1,145 @@
+// Package smtptest runs an in-process SMTP server for tests, like net/http/httptest does for HTTP
+package smtptest
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is a mail the server accepted
+type Message struct {
+	From string
+	To   []string
+	Data string // headers and body, with LF line endings
+}
+
+// Server accepts every mail on a loopback port and keeps it in memory. It offers no
+// extensions, so clients talk plain SMTP without STARTTLS or AUTH.
+type Server struct {
+	Addr string // host:port to send to
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	reject   bool
+	messages []Message
+}
+
+// NewServer starts a server. Close it when done.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("smtptest: failed to listen: " + err.Error())
+	}
+	s := &Server{Addr: l.Addr().String(), listener: l}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// RejectRecipients makes the server refuse every recipient from now on, for testing failed sends
+func (s *Server) RejectRecipients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reject = true
+}
+
+// Messages returns the mails accepted so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	c.PrintfLine("220 smtptest ready")
+	var msg Message
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250 smtptest")
+		case "MAIL":
+			msg = Message{From: address(arg)}
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			reject := s.reject
+			s.mu.Unlock()
+			if reject {
+				c.PrintfLine("550 mailbox unavailable")
+				continue
+			}
+			msg.To = append(msg.To, address(arg))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			if len(msg.To) == 0 {
+				c.PrintfLine("503 no recipients")
+				continue
+			}
+			c.PrintfLine("354 end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(c.DotReader())
+			if err != nil {
+				return
+			}
+			msg.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = Message{}
+			c.PrintfLine("250 OK")
+		case "RSET":
+			msg = Message{}
+			c.PrintfLine("250 OK")
+		case "NOOP":
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// address takes the mailbox out of a MAIL or RCPT argument such as "FROM:<a@b.c> BODY=8BITMIME"
+func address(arg string) string {
+	_, rest, ok := strings.Cut(arg, "<")
+	if !ok {
+		return ""
+	}
+	addr, _, _ := strings.Cut(rest, ">")
+	return addr
+}
@@ -0,0 +1,73 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// WebhookChannel POSTs each notification as JSON to one URL. With a secret, the body's
+// HMAC-SHA256 is sent hex encoded in X-Signature-256 so the receiver can check the sender.
+type WebhookChannel struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookChannelFromEnv reads NOTIFY_WEBHOOK_URL and the optional NOTIFY_WEBHOOK_SECRET
+func NewWebhookChannelFromEnv() (*WebhookChannel, error) {
+	url := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if url == "" {
+		return nil, fmt.Errorf("the webhook channel needs NOTIFY_WEBHOOK_URL")
+	}
+	return &WebhookChannel{
+		url:    url,
+		secret: []byte(os.Getenv("NOTIFY_WEBHOOK_SECRET")),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+func (c *WebhookChannel) Send(m Message) error {
+	// The receiver gets the user ID only, the address stays with the email channel
+	m.Email = ""
+	body, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Receivers can deduplicate retries on the notification ID
+	req.Header.Set("X-Notification-ID", fmt.Sprint(m.ID))
+	if len(c.secret) > 0 {
+		mac := hmac.New(sha256.New, c.secret)
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
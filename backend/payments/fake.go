@@ -0,0 +1,129 @@
+package payments
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FakeDeclineAmount makes the fake provider decline an authorization, handy for exercising error paths
+const FakeDeclineAmount = 99999
+
+const (
+	fakePaymentPrefix = "fake_pay_"
+	fakePayoutPrefix  = "fake_po_"
+)
+
+// FakeProvider keeps payments in memory and never moves real money. It follows the contract
+// of card processors: a payment is captured once, which releases the rest of the hold, an
+// uncaptured one can be released, and only captured money can be refunded. IDs are derived
+// from the reference, so the same calls give the same IDs across restarts. Payments it forgot about
+// in a restart are accepted without amount checks, and so are repeated captures and refunds.
+type FakeProvider struct {
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	done     map[string]bool // references of the captures and refunds made so far
+}
+
+type fakePayment struct {
+	authorized int64
+	captured   int64
+	refunded   int64
+	closed     bool // captured or released, the hold is gone
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{payments: make(map[string]*fakePayment), done: make(map[string]bool)}
+}
+
+func (p *FakeProvider) Authorize(customerID int64, amount int64, reference string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if amount <= 0 || amount == FakeDeclineAmount {
+		return "", ErrDeclined
+	}
+
+	id := fakePaymentPrefix + reference
+	if _, ok := p.payments[id]; !ok {
+		p.payments[id] = &fakePayment{authorized: amount}
+	}
+	return id, nil
+}
+
+// lookup returns the payment, nil for a fake payment from before a restart
+func (p *FakeProvider) lookup(paymentID string) (*fakePayment, error) {
+	payment, ok := p.payments[paymentID]
+	if !ok && !strings.HasPrefix(paymentID, fakePaymentPrefix) {
+		return nil, ErrUnknownPayment
+	}
+	return payment, nil
+}
+
+func (p *FakeProvider) Capture(paymentID string, amount int64, reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done[reference] {
+		return nil
+	}
+	payment, err := p.lookup(paymentID)
+	if err != nil || payment == nil {
+		return err
+	}
+	if payment.closed {
+		return fmt.Errorf("payment was already captured or released: %w", ErrDeclined)
+	}
+	if amount <= 0 || amount > payment.authorized {
+		return fmt.Errorf("capture of %d exceeds the authorized amount: %w", amount, ErrDeclined)
+	}
+	payment.captured = amount
+	payment.closed = true
+	p.done[reference] = true
+	return nil
+}
+
+func (p *FakeProvider) Release(paymentID string, reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done[reference] {
+		return nil
+	}
+	payment, err := p.lookup(paymentID)
+	if err != nil || payment == nil {
+		return err
+	}
+	if payment.closed {
+		return fmt.Errorf("payment was already captured or released: %w", ErrDeclined)
+	}
+	payment.closed = true
+	p.done[reference] = true
+	return nil
+}
+
+func (p *FakeProvider) Refund(paymentID string, amount int64, reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done[reference] {
+		return nil
+	}
+	payment, err := p.lookup(paymentID)
+	if err != nil || payment == nil {
+		return err
+	}
+	if amount <= 0 || payment.refunded+amount > payment.captured {
+		return fmt.Errorf("refund of %d exceeds the captured amount: %w", amount, ErrDeclined)
+	}
+	payment.refunded += amount
+	p.done[reference] = true
+	return nil
+}
+
+func (p *FakeProvider) Payout(accountID int64, amount int64, reference string) (string, error) {
+	if amount <= 0 {
+		return "", fmt.Errorf("payout of %d to %d: %w", amount, accountID, ErrDeclined)
+	}
+	return fakePayoutPrefix + reference, nil
+}
@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func authorize(t *testing.T, p *FakeProvider, amount int64, reference string) string {
+	t.Helper()
+	id, err := p.Authorize(2, amount, reference)
+	if err != nil {
+		t.Fatalf("Authorize(%d, %q): %v", amount, reference, err)
+	}
+	return id
+}
+
+func TestFakeAuthorize(t *testing.T) {
+	p := NewFakeProvider()
+
+	id := authorize(t, p, 5000, "rental-1")
+	if id != "fake_pay_rental-1" {
+		t.Errorf("payment ID = %q, want fake_pay_rental-1", id)
+	}
+	// A retry with the same reference gets the same payment, not a second hold
+	if again := authorize(t, p, 5000, "rental-1"); again != id {
+		t.Errorf("retried Authorize = %q, want %q", again, id)
+	}
+
+	for _, amount := range []int64{0, -100, FakeDeclineAmount} {
+		if _, err := p.Authorize(2, amount, "rental-2"); !errors.Is(err, ErrDeclined) {
+			t.Errorf("Authorize(%d) = %v, want ErrDeclined", amount, err)
+		}
+	}
+}
+
+func TestFakeCapture(t *testing.T) {
+	p := NewFakeProvider()
+	id := authorize(t, p, 5000, "rental-1")
+
+	if err := p.Capture(id, 6000, "rental-1-capture"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("capture over the authorization = %v, want ErrDeclined", err)
+	}
+	if err := p.Capture(id, 3000, "rental-1-capture"); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	// Retried with the same reference it's a no-op
+	if err := p.Capture(id, 3000, "rental-1-capture"); err != nil {
+		t.Errorf("retried Capture: %v", err)
+	}
+	// The partial capture released the rest, there's nothing left to capture or release
+	if err := p.Capture(id, 1000, "rental-1-capture-again"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("second capture = %v, want ErrDeclined", err)
+	}
+	if err := p.Release(id, "rental-1-release"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("release after capture = %v, want ErrDeclined", err)
+	}
+	if got := p.payments[id].captured; got != 3000 {
+		t.Errorf("captured = %d, want 3000", got)
+	}
+}
+
+func TestFakeRelease(t *testing.T) {
+	p := NewFakeProvider()
+	id := authorize(t, p, 5000, "rental-1")
+
+	if err := p.Release(id, "rental-1-release"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := p.Release(id, "rental-1-release"); err != nil {
+		t.Errorf("retried Release: %v", err)
+	}
+	if err := p.Capture(id, 5000, "rental-1-capture"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("capture after release = %v, want ErrDeclined", err)
+	}
+	if err := p.Refund(id, 5000, "rental-1-refund"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("refund of a released payment = %v, want ErrDeclined", err)
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	p := NewFakeProvider()
+	id := authorize(t, p, 5000, "rental-1")
+
+	if err := p.Refund(id, 1000, "rental-1-refund"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("refund before capture = %v, want ErrDeclined", err)
+	}
+	if err := p.Capture(id, 4000, "rental-1-capture"); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if err := p.Refund(id, 2500, "rental-1-refund"); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	// A retry doesn't pay back twice, so the remaining 1500 can still be refunded once
+	if err := p.Refund(id, 2500, "rental-1-refund"); err != nil {
+		t.Errorf("retried Refund: %v", err)
+	}
+	if err := p.Refund(id, 1500, "rental-1-refund-rest"); err != nil {
+		t.Errorf("refunding the rest: %v", err)
+	}
+	if err := p.Refund(id, 1, "rental-1-refund-more"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("refund beyond the capture = %v, want ErrDeclined", err)
+	}
+}
+
+func TestFakeUnknownPayment(t *testing.T) {
+	p := NewFakeProvider()
+
+	if err := p.Capture("pi_123", 100, "rental-1-capture"); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("Capture of a foreign ID = %v, want ErrUnknownPayment", err)
+	}
+	if err := p.Release("pi_123", "rental-1-release"); !errors.Is(err, ErrUnknownPayment) {
+		t.Errorf("Release of a foreign ID = %v, want ErrUnknownPayment", err)
+	}
+	// Fake payments from before a restart are taken on trust
+	if err := p.Capture("fake_pay_rental-9", 100, "rental-9-capture"); err != nil {
+		t.Errorf("Capture of a forgotten fake payment: %v", err)
+	}
+}
+
+func TestFakePayout(t *testing.T) {
+	p := NewFakeProvider()
+
+	id, err := p.Payout(1, 4500, "rental-1-payout")
+	if err != nil {
+		t.Fatalf("Payout: %v", err)
+	}
+	if again, _ := p.Payout(1, 4500, "rental-1-payout"); again != id {
+		t.Errorf("retried Payout = %q, want %q", again, id)
+	}
+	if _, err := p.Payout(1, 0, "rental-2-payout"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("Payout of 0 = %v, want ErrDeclined", err)
+	}
+}
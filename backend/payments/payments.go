@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrDeclined is returned when the provider refuses to move the money
+var ErrDeclined = errors.New("payment declined")
+
+// ErrUnknownPayment is returned for a payment ID the provider never issued
+var ErrUnknownPayment = errors.New("unknown payment")
+
+// PaymentProvider moves money for rentals. Amounts are in cents like items.i_price.
+// Every call takes a reference (e.g. "rental-12-capture") the provider uses as an idempotency key:
+// a call repeated with the same reference doesn't move the money again.
+type PaymentProvider interface {
+	// Authorize holds amount on the customer's payment method and returns a payment ID
+	Authorize(customerID int64, amount int64, reference string) (string, error)
+	// Capture takes up to the authorized amount of a payment, once. The rest of the
+	// authorization is released.
+	Capture(paymentID string, amount int64, reference string) error
+	// Release gives back the whole hold of a payment that was never captured
+	Release(paymentID string, reference string) error
+	// Refund gives amount of a captured payment back, up to what was captured
+	Refund(paymentID string, amount int64, reference string) error
+	// Payout sends amount to an account holder and returns a payout ID
+	Payout(accountID int64, amount int64, reference string) (string, error)
+}
+
+// Default is the provider used by the rental workflow, set up by InitProvider
+var Default PaymentProvider
+
+// InitProvider picks the provider from PAYMENT_PROVIDER. Only "fake" (the default) exists so far.
+func InitProvider() error {
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "", "fake":
+		Default = NewFakeProvider()
+	default:
+		return fmt.Errorf("unknown PAYMENT_PROVIDER %q", provider)
+	}
+	return nil
+}
@@ -2,9 +2,11 @@ package router
 
 import (
 	"database/sql"
+	"net/http"
 
 	"github.com/LuaanNguyen/backend/handlers"
 	"github.com/LuaanNguyen/backend/middleware"
+	"github.com/LuaanNguyen/backend/models"
 	"github.com/gorilla/mux"
 )
 
@@ -15,43 +17,116 @@ func Router(db *sql.DB) *mux.Router {
 	//  -------------- Public routes (no auth required)  --------------
 	router.HandleFunc("/healthcheck", handlers.HealthCheck).Methods("GET", "OPTIONS")
 	router.HandleFunc("/login", handlers.Login).Methods("POST", "OPTIONS")
+	router.HandleFunc("/register", handlers.Register).Methods("POST", "OPTIONS")
+	router.HandleFunc("/token/refresh", handlers.RefreshToken).Methods("POST", "OPTIONS")
+	router.Handle("/logout", middleware.AuthMiddleware(http.HandlerFunc(handlers.Logout))).Methods("POST", "OPTIONS")
+
+	// Photos are loaded by <img> tags, which can't send the Authorization header
+	router.HandleFunc("/api/items/{id}/images/{n:[0-9]+}", handlers.ServeItemImage).Methods("GET", "OPTIONS")
+
+	// EventSource can't send the Authorization header either, so the stream also takes ?access_token=
+	router.Handle("/api/events", middleware.StreamAuthMiddleware(http.HandlerFunc(handlers.StreamEvents))).Methods("GET", "OPTIONS")
 
 	// -------------- Protected routes with /api/ prefix  --------------
 	protected := router.PathPrefix("/api").Subrouter()
 	protected.Use(middleware.AuthMiddleware)  // Auth only for protected routes
+
+	// Guards for routes that need more than a logged in user
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
+	staffOnly := middleware.RequireRole(models.RoleModerator, models.RoleAdmin)
 	
 	// User routes
-	protected.HandleFunc("/users", handlers.GetAllUser).Methods("GET", "OPTIONS")
+	protected.Handle("/users", adminOnly(http.HandlerFunc(handlers.GetAllUser))).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/user/{id}", handlers.GetUser).Methods("GET", "OPTIONS")
+	protected.Handle("/user/{id}/role", adminOnly(http.HandlerFunc(handlers.UpdateUserRole))).Methods("PUT", "OPTIONS")
 
 	// Item routes
 	protected.HandleFunc("/items", handlers.GetAllItems).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/items", handlers.CreateItem).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/items/available", handlers.GetAvailableItems).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/items/search", handlers.SearchItems).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/items/{id}", handlers.GetItem).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/items/{id}", handlers.UpdateItem).Methods("PUT", "OPTIONS")
 	protected.HandleFunc("/items/{id}", handlers.DeleteItem).Methods("DELETE", "OPTIONS")
-	protected.HandleFunc("/items/search", handlers.SearchItems).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/items/{id}/quote", handlers.GetQuote).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/items/{id}/availability", handlers.GetItemAvailability).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/items/{id}/blackouts", handlers.CreateBlackout).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/items/{id}/blackouts/{blackoutId}", handlers.DeleteBlackout).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/items/{id}/images", handlers.GetItemImages).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/items/{id}/images", handlers.UploadItemImages).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/items/{id}/images/order", handlers.ReorderItemImages).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/items/{id}/images/{n:[0-9]+}", handlers.DeleteItemImage).Methods("DELETE", "OPTIONS")
 
 	// Rental routes
 	protected.HandleFunc("/rentals", handlers.CreateRentalRequest).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/rentals/my", handlers.GetMyRentals).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/incoming", handlers.GetIncomingRentals).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/overdue", handlers.GetOverdueRentals).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/approve", handlers.ChangeRentalStatus(models.RentalApproved)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/reject", handlers.ChangeRentalStatus(models.RentalRejected)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/cancel", handlers.ChangeRentalStatus(models.RentalCancelled)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/complete", handlers.ChangeRentalStatus(models.RentalCompleted)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/refund", handlers.GetCancellationRefund).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/checkout", handlers.ConfirmHandover(models.HandoverCheckout)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/checkin", handlers.ConfirmHandover(models.HandoverCheckin)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/handovers", handlers.GetHandoverReports).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/handovers/photos/{photoId}", handlers.ServeHandoverPhoto).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/extend", handlers.RequestExtension).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/extensions", handlers.GetRentalExtensions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/extensions/{extensionId}/approve", handlers.DecideExtension(models.ExtensionApproved)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/extensions/{extensionId}/reject", handlers.DecideExtension(models.ExtensionRejected)).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/extensions/{extensionId}/cancel", handlers.DecideExtension(models.ExtensionCancelled)).Methods("POST", "OPTIONS")
 
 	// Category routes
 	protected.HandleFunc("/categories", handlers.GetAllCategories).Methods("GET", "OPTIONS")
+	protected.Handle("/categories", adminOnly(http.HandlerFunc(handlers.CreateCategory))).Methods("POST", "OPTIONS")
+	protected.Handle("/categories/{id}", adminOnly(http.HandlerFunc(handlers.UpdateCategory))).Methods("PUT", "OPTIONS")
+	protected.Handle("/categories/{id}", adminOnly(http.HandlerFunc(handlers.DeleteCategory))).Methods("DELETE", "OPTIONS")
+
+	// Deposit damage claim routes
+	protected.HandleFunc("/rentals/{id}/claim", handlers.CreateDamageClaim).Methods("POST", "OPTIONS")
+	protected.Handle("/claims", staffOnly(http.HandlerFunc(handlers.GetDamageClaims))).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/claims/{id}", handlers.GetDamageClaim).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/claims/{id}/evidence", handlers.UploadClaimEvidence).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/claims/{id}/evidence/{evidenceId}", handlers.ServeClaimEvidence).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/claims/{id}/respond", handlers.RespondToDamageClaim).Methods("POST", "OPTIONS")
+	protected.Handle("/claims/{id}/resolve", staffOnly(http.HandlerFunc(handlers.ResolveDamageClaim))).Methods("POST", "OPTIONS")
+
+	// Dispute routes, moderators rule on the rental payment
+	protected.HandleFunc("/rentals/{id}/disputes", handlers.OpenDispute).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/rentals/{id}/disputes", handlers.GetRentalDisputes).Methods("GET", "OPTIONS")
+	protected.Handle("/disputes", staffOnly(http.HandlerFunc(handlers.GetDisputes))).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/disputes/{id}", handlers.GetDispute).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/disputes/{id}/evidence", handlers.UploadDisputeEvidence).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/disputes/{id}/evidence/{evidenceId}", handlers.ServeDisputeEvidence).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/disputes/{id}/respond", handlers.RespondToDispute).Methods("POST", "OPTIONS")
+	protected.Handle("/disputes/{id}/resolve", staffOnly(http.HandlerFunc(handlers.ResolveDispute))).Methods("POST", "OPTIONS")
+
+	// Messaging routes, only the two participants see a conversation
+	protected.HandleFunc("/conversations", handlers.StartConversation).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/conversations", handlers.GetConversations).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/conversations/unread", handlers.GetUnreadMessageCount).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/conversations/{id}", handlers.GetConversation).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/conversations/{id}/messages", handlers.GetMessages).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/conversations/{id}/messages", handlers.SendMessage).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/conversations/{id}/read", handlers.MarkConversationRead).Methods("POST", "OPTIONS")
+
+	// Notification inbox, each user only sees their own
+	protected.HandleFunc("/notifications", handlers.GetNotifications).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notifications/unread", handlers.GetUnreadNotificationCount).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notifications/read", handlers.MarkAllNotificationsRead).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/notifications/preferences", handlers.GetNotificationSettings).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notifications/preferences", handlers.UpdateNotificationSettings).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/notifications/{id}/read", handlers.MarkNotificationRead).Methods("POST", "OPTIONS")
 
-	// Transaction routes
-	// protected.HandleFunc("/transactions", handlers.CreateTransaction).Methods("POST")
-	// protected.HandleFunc("/user/{id}/transactions", handlers.GetUserTransactions)
-	// protected.HandleFunc("/transactions/{id}", handlers.GetTransaction)
-	// protected.HandleFunc("/transactions/{id}", handlers.UpdateTransaction).Methods("PUT")
+	// Transaction routes, entries are only written by the rental lifecycle
+	protected.HandleFunc("/transactions", handlers.GetTransactions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/transactions/{id}", handlers.GetTransaction).Methods("GET", "OPTIONS")
 
 	// Review routes
-	// protected.HandleFunc("/reviews", handlers.CreateReview).Methods("POST")
-	// protected.HandleFunc("/items/{id}/reviews", handlers.GetItemReviews)
-	// protected.HandleFunc("/user/{id}/reviews", handlers.GetUserReviews)
-	// protected.HandleFunc("/reviews/{id}", handlers.UpdateReview).Methods("PUT")
-	// protected.HandleFunc("/reviews/{id}", handlers.DeleteReview).Methods("DELETE")
+	protected.HandleFunc("/rentals/{id}/review", handlers.CreateRentalReview).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/items/{id}/reviews", handlers.GetItemReviews).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/user/{id}/reviews", handlers.GetUserReviews).Methods("GET", "OPTIONS")
 
 	return router
 }
\ No newline at end of file
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/LuaanNguyen/backend/db"
+)
+
+// PostgresStore keeps objects in the image_blobs table
+type PostgresStore struct{}
+
+func NewPostgresStore() *PostgresStore {
+	return &PostgresStore{}
+}
+
+func (s *PostgresStore) Put(key string, data []byte, contentType string) error {
+	_, err := db.DB.Exec(`
+		INSERT INTO image_blobs (key, data, content_type)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, content_type = EXCLUDED.content_type`,
+		key, data, contentType)
+	if err != nil {
+		return fmt.Errorf("error storing blob: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(key string) ([]byte, error) {
+	var data []byte
+	err := db.DB.QueryRow("SELECT data FROM image_blobs WHERE key = $1", key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob: %v", err)
+	}
+	return data, nil
+}
+
+func (s *PostgresStore) Delete(key string) error {
+	if _, err := db.DB.Exec("DELETE FROM image_blobs WHERE key = $1", key); err != nil {
+		return fmt.Errorf("error deleting blob: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNotFound is returned by Get for a key that was never stored or was deleted
+var ErrNotFound = errors.New("object not found")
+
+// Store is a place to keep binary objects (item photos and thumbnails) by key
+type Store interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Default is the store used by the handlers, set up by InitStore
+var Default Store
+
+// InitStore picks the backend from IMAGE_STORAGE: "postgres" (default) or "local".
+// The local backend writes under IMAGE_DIR, "uploads" if unset.
+func InitStore() error {
+	switch backend := os.Getenv("IMAGE_STORAGE"); backend {
+	case "", "postgres":
+		Default = NewPostgresStore()
+	case "local":
+		dir := os.Getenv("IMAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		store, err := NewFileStore(dir)
+		if err != nil {
+			return err
+		}
+		Default = store
+	default:
+		return fmt.Errorf("unknown IMAGE_STORAGE %q", backend)
+	}
+	return nil
+}
+
+// NewKey returns a fresh random key under prefix, e.g. "items/12/3f9a..."
+func NewKey(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating key: %v", err)
+	}
+	return prefix + "/" + hex.EncodeToString(b), nil
+}
@@ -33,6 +33,7 @@ export function setAuth(loginResponse: LoginResponse): void {
 	// Set the token and user in localStorage
 	if (browser) {
 		localStorage.setItem('token', loginResponse.token);
+		localStorage.setItem('refresh_token', loginResponse.refresh_token);
 		const userData: User = {
 			id: loginResponse.user_id,
 			first_name: loginResponse.first_name,
@@ -53,6 +54,7 @@ export function clearAuth(): void {
 	// Clear from localStorage
 	if (browser) {
 		localStorage.removeItem('token');
+		localStorage.removeItem('refresh_token');
 		localStorage.removeItem('user');
 	}
 
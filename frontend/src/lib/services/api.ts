@@ -5,7 +5,19 @@ import type {
 	RentalRequest,
 	SearchParams,
 	ItemWithOwner,
-	RentalWithDetails
+	RentalWithDetails,
+	RegisterRequest,
+	LoginResponse,
+	Quote,
+	Availability,
+	Transaction,
+	Conversation,
+	Message,
+	MessagePage,
+	NotificationPage,
+	Notification,
+	NotificationSettings,
+	LiveEvent
 } from '../types';
 
 const API_URL = 'http://localhost:8080';
@@ -59,6 +71,49 @@ export async function login(email: string, password: string) {
 	}
 }
 
+export async function register(data: RegisterRequest): Promise<LoginResponse> {
+	const options = getCommonOptions();
+	options.method = 'POST';
+	options.body = JSON.stringify(data);
+
+	try {
+		const response = await fetch(`${API_URL}/register`, options);
+		return handleResponse<LoginResponse>(response);
+	} catch (error) {
+		console.error('Register error:', error);
+		throw error;
+	}
+}
+
+export async function refreshToken(refresh_token: string): Promise<LoginResponse> {
+	const options = getCommonOptions();
+	options.method = 'POST';
+	options.body = JSON.stringify({ refresh_token });
+
+	try {
+		const response = await fetch(`${API_URL}/token/refresh`, options);
+		return handleResponse<LoginResponse>(response);
+	} catch (error) {
+		console.error('Refresh token error:', error);
+		throw error;
+	}
+}
+
+export async function logout(refresh_token: string | null): Promise<{ message: string }> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+	options.body = JSON.stringify({ refresh_token: refresh_token ?? '' });
+
+	try {
+		const response = await fetch(`${API_URL}/logout`, options);
+		return handleResponse<{ message: string }>(response);
+	} catch (error) {
+		console.error('Logout error:', error);
+		throw error;
+	}
+}
+
 // User endpoints
 export async function getAllUsers(): Promise<User[]> {
 	const token = getToken();
@@ -178,6 +233,9 @@ export async function searchItems(params: SearchParams): Promise<Item[]> {
 	if (params.minPrice !== undefined) searchParams.append('min_price', params.minPrice.toString());
 	if (params.maxPrice !== undefined) searchParams.append('max_price', params.maxPrice.toString());
 	if (params.available !== undefined) searchParams.append('available', params.available.toString());
+	if (params.minRating !== undefined)
+		searchParams.append('min_rating', params.minRating.toString());
+	if (params.sort) searchParams.append('sort', params.sort);
 
 	const token = getToken();
 	const options = getCommonOptions(token);
@@ -191,6 +249,44 @@ export async function searchItems(params: SearchParams): Promise<Item[]> {
 	}
 }
 
+export async function getQuote(itemId: number, start: string, end: string): Promise<Quote> {
+	const searchParams = new URLSearchParams({ start, end });
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(`${API_URL}/api/items/${itemId}/quote?${searchParams}`, options);
+		return handleResponse<Quote>(response);
+	} catch (error) {
+		console.error(`Error quoting item ${itemId}:`, error);
+		throw error;
+	}
+}
+
+export async function getItemAvailability(
+	itemId: number,
+	from?: string,
+	to?: string
+): Promise<Availability> {
+	const searchParams = new URLSearchParams();
+	if (from) searchParams.append('from', from);
+	if (to) searchParams.append('to', to);
+
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(
+			`${API_URL}/api/items/${itemId}/availability?${searchParams}`,
+			options
+		);
+		return handleResponse<Availability>(response);
+	} catch (error) {
+		console.error(`Error fetching availability for item ${itemId}:`, error);
+		throw error;
+	}
+}
+
 // Category endpoints
 export async function getAllCategories(): Promise<Category[]> {
 	const token = getToken();
@@ -233,3 +329,205 @@ export async function getMyRentals(): Promise<RentalWithDetails[]> {
 		throw error;
 	}
 }
+
+// Transaction endpoints
+export async function getTransactions(): Promise<Transaction[]> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(`${API_URL}/api/transactions`, options);
+		return handleResponse<Transaction[]>(response);
+	} catch (error) {
+		console.error('Error fetching transactions:', error);
+		throw error;
+	}
+}
+
+// Messaging endpoints
+export async function getConversations(): Promise<Conversation[]> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(`${API_URL}/api/conversations`, options);
+		return handleResponse<Conversation[]>(response);
+	} catch (error) {
+		console.error('Error fetching conversations:', error);
+		throw error;
+	}
+}
+
+export async function startConversation(target: {
+	item_id?: number;
+	rental_id?: number;
+}): Promise<Conversation> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+	options.body = JSON.stringify(target);
+
+	try {
+		const response = await fetch(`${API_URL}/api/conversations`, options);
+		return handleResponse<Conversation>(response);
+	} catch (error) {
+		console.error('Error starting conversation:', error);
+		throw error;
+	}
+}
+
+export async function getMessages(conversationId: number, before?: number): Promise<MessagePage> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	const query = before ? `?before=${before}` : '';
+
+	try {
+		const response = await fetch(
+			`${API_URL}/api/conversations/${conversationId}/messages${query}`,
+			options
+		);
+		return handleResponse<MessagePage>(response);
+	} catch (error) {
+		console.error('Error fetching messages:', error);
+		throw error;
+	}
+}
+
+export async function sendMessage(conversationId: number, body: string): Promise<Message> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+	options.body = JSON.stringify({ body });
+
+	try {
+		const response = await fetch(`${API_URL}/api/conversations/${conversationId}/messages`, options);
+		return handleResponse<Message>(response);
+	} catch (error) {
+		console.error('Error sending message:', error);
+		throw error;
+	}
+}
+
+export async function markConversationRead(conversationId: number): Promise<{ read: number }> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+
+	try {
+		const response = await fetch(`${API_URL}/api/conversations/${conversationId}/read`, options);
+		return handleResponse<{ read: number }>(response);
+	} catch (error) {
+		console.error('Error marking conversation read:', error);
+		throw error;
+	}
+}
+
+// Notifications
+export async function getNotifications(unreadOnly = false, before?: number): Promise<NotificationPage> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	const params = new URLSearchParams();
+	if (unreadOnly) params.set('unread', 'true');
+	if (before) params.set('before', String(before));
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications?${params}`, options);
+		return handleResponse<NotificationPage>(response);
+	} catch (error) {
+		console.error('Error fetching notifications:', error);
+		throw error;
+	}
+}
+
+export async function getUnreadNotificationCount(): Promise<{ unread: number }> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications/unread`, options);
+		return handleResponse<{ unread: number }>(response);
+	} catch (error) {
+		console.error('Error counting unread notifications:', error);
+		throw error;
+	}
+}
+
+export async function markNotificationRead(id: number): Promise<Notification> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications/${id}/read`, options);
+		return handleResponse<Notification>(response);
+	} catch (error) {
+		console.error('Error marking notification read:', error);
+		throw error;
+	}
+}
+
+export async function markAllNotificationsRead(): Promise<{ read: number }> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'POST';
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications/read`, options);
+		return handleResponse<{ read: number }>(response);
+	} catch (error) {
+		console.error('Error marking notifications read:', error);
+		throw error;
+	}
+}
+
+export async function getNotificationSettings(): Promise<NotificationSettings> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications/preferences`, options);
+		return handleResponse<NotificationSettings>(response);
+	} catch (error) {
+		console.error('Error fetching notification preferences:', error);
+		throw error;
+	}
+}
+
+export async function updateNotificationSettings(
+	settings: Omit<NotificationSettings, 'kinds'> & { kinds?: Partial<NotificationSettings['kinds']> }
+): Promise<NotificationSettings> {
+	const token = getToken();
+	const options = getCommonOptions(token);
+	options.method = 'PUT';
+	options.body = JSON.stringify(settings);
+
+	try {
+		const response = await fetch(`${API_URL}/api/notifications/preferences`, options);
+		return handleResponse<NotificationSettings>(response);
+	} catch (error) {
+		console.error('Error updating notification preferences:', error);
+		throw error;
+	}
+}
+
+// Live updates. EventSource can't send headers, so the token goes in the query string.
+// The browser reconnects on its own; refetch on 'open' since missed events aren't replayed.
+const liveEventTypes: LiveEvent['type'][] = [
+	'rental.status',
+	'rental.requested',
+	'message.created',
+	'messages.read',
+	'notification.created'
+];
+
+export function subscribeToEvents(onEvent: (event: LiveEvent) => void): EventSource {
+	const token = getToken() ?? '';
+	const source = new EventSource(`${API_URL}/api/events?access_token=${encodeURIComponent(token)}`);
+
+	for (const type of liveEventTypes) {
+		source.addEventListener(type, (e) => {
+			onEvent({ type, data: JSON.parse((e as MessageEvent).data) } as LiveEvent);
+		});
+	}
+	return source;
+}
@@ -7,17 +7,24 @@ export interface Item {
 	price: number;
 	quantity: number;
 	available: boolean;
-	image?: string;
+	deposit?: number;
+	cancellation_policy?: CancellationPolicy;
+	late_fee?: number;
+	image_url?: string;
 	date_listed?: Date;
+	rating?: number;
+	review_count?: number;
 }
 
 export interface User {
 	id: number;
-	email: string;
-	phone_number: string;
+	email?: string; // only on your own profile, or for staff
+	phone_number?: string;
 	first_name: string;
 	last_name: string;
 	nick_name?: string;
+	role?: 'user' | 'moderator' | 'admin';
+	reputation?: Reputation;
 }
 
 export interface Category {
@@ -42,8 +49,12 @@ export interface SearchParams {
 	minPrice?: number;
 	maxPrice?: number;
 	available?: boolean;
+	minRating?: number;
+	sort?: ItemSort;
 }
 
+export type ItemSort = 'newest' | 'rating' | 'price_asc' | 'price_desc';
+
 export interface ItemWithOwner {
 	id: number;
 	name: string;
@@ -52,15 +63,31 @@ export interface ItemWithOwner {
 	owner_id: number;
 	owner_name: string;
 	available: boolean;
+	image_url?: string;
+	rating: number;
+	review_count: number;
+	owner_rating: number;
+	owner_review_count: number;
 }
 
 export interface LoginResponse {
 	token: string;
+	refresh_token: string;
+	expires_in: number;
 	user_id: number;
 	first_name: string;
 	last_name: string;
 }
 
+export interface RegisterRequest {
+	email: string;
+	phone_number?: string;
+	first_name: string;
+	last_name: string;
+	nick_name?: string;
+	password: string;
+}
+
 export interface RentalWithDetails {
 	id: number;
 	item_id: number;
@@ -71,4 +98,334 @@ export interface RentalWithDetails {
 	status: string;
 	total_price: number;
 	owner_name: string;
+	dispute_id?: number | null;
+	dispute_status?: DisputeStatus | null;
+}
+
+export interface QuoteLine {
+	label: string;
+	amount: number;
+}
+
+export interface Quote {
+	item_id: number;
+	start_date: string;
+	end_date: string;
+	days: number;
+	daily_rate: number;
+	subtotal: number;
+	service_fee: number;
+	total: number;
+	lines: QuoteLine[];
+}
+
+export interface BookedRange {
+	start_date: string;
+	end_date: string;
+}
+
+export interface Blackout {
+	id?: number;
+	item_id?: number;
+	start_date: string;
+	end_date: string;
+	reason?: string;
+}
+
+export interface Availability {
+	item_id: number;
+	quantity: number;
+	from: string;
+	to: string;
+	booked: BookedRange[];
+	pending: BookedRange[];
+	blocked: Blackout[];
+}
+
+export interface ItemImage {
+	id: number;
+	item_id: number;
+	position: number;
+	content_type: string;
+	size: number;
+	url: string;
+	thumbnail_url: string;
+	created_at: string;
+}
+
+export interface Review {
+	id: number;
+	comment: string;
+	star: number;
+	user_id: number;
+	reviewer_name: string;
+	reviewee_id?: number;
+	rental_id?: number;
+	item_id?: number;
+	direction?: 'renter_to_owner' | 'owner_to_renter';
+	item_star?: number;
+	condition_star?: number;
+	on_time?: boolean;
+	published: boolean;
+	created_at: string;
+}
+
+export interface RatingSummary {
+	average: number;
+	count: number;
+}
+
+export interface Reputation {
+	as_owner: RatingSummary;
+	as_renter: RatingSummary;
+	item_rating: RatingSummary;
+	condition_score: RatingSummary;
+	on_time_rate?: number;
+}
+
+export type TransactionType =
+	| 'Charge'
+	| 'Payout'
+	| 'Fee'
+	| 'Refund'
+	| 'DepositHold'
+	| 'DepositRelease'
+	| 'DepositCapture';
+
+// Ledger entry, amount is positive cents and type says which way the money moved
+export interface Transaction {
+	id: number;
+	user_id: number;
+	type: TransactionType;
+	item_id: number;
+	rental_id?: number;
+	date: string;
+	amount: number;
+	reference?: string;
+}
+
+export type ClaimStatus = 'open' | 'accepted' | 'contested' | 'resolved';
+
+export interface ClaimEvidence {
+	id: number;
+	claim_id: number;
+	content_type: string;
+	size: number;
+	url: string;
+	created_at: string;
+}
+
+export interface DamageClaim {
+	id: number;
+	rental_id: number;
+	item_id: number;
+	owner_id: number;
+	renter_id: number;
+	amount: number;
+	description: string;
+	status: ClaimStatus;
+	renter_response?: string;
+	responded_at?: string;
+	captured_amount?: number;
+	resolved_by?: number;
+	resolved_at?: string;
+	created_at: string;
+	evidence: ClaimEvidence[];
+}
+
+export type CancellationPolicy = 'flexible' | 'moderate' | 'strict';
+
+export interface Refund {
+	policy: CancellationPolicy;
+	percent: number;
+	amount: number;
 }
+
+export type HandoverKind = 'checkout' | 'checkin';
+
+export interface HandoverPhoto {
+	id: number;
+	report_id: number;
+	rental_id: number;
+	uploaded_by: number;
+	content_type: string;
+	size: number;
+	url: string;
+	created_at: string;
+}
+
+export interface HandoverReport {
+	id: number;
+	rental_id: number;
+	kind: HandoverKind;
+	owner_confirmed_at?: string;
+	renter_confirmed_at?: string;
+	owner_notes?: string;
+	renter_notes?: string;
+	completed_at?: string;
+	created_at: string;
+	photos: HandoverPhoto[];
+}
+
+export type ExtensionStatus = 'pending' | 'approved' | 'rejected' | 'cancelled';
+
+export interface RentalExtension {
+	id: number;
+	rental_id: number;
+	requested_by: number;
+	previous_end_date: string;
+	new_end_date: string;
+	extra_price: number;
+	extra_service_fee: number;
+	status: ExtensionStatus;
+	decided_by?: number;
+	decided_at?: string;
+	created_at: string;
+}
+
+export type DisputeStatus = 'open' | 'responded' | 'resolved';
+export type DisputeReason = 'not_as_described' | 'damaged' | 'no_show' | 'late_return' | 'other';
+export type DisputeRuling = 'refund' | 'partial_capture' | 'no_action';
+
+export interface DisputeEvidence {
+	id: number;
+	dispute_id: number;
+	uploaded_by: number;
+	content_type: string;
+	size: number;
+	url: string;
+	created_at: string;
+}
+
+export interface DisputeEvent {
+	id: number;
+	dispute_id: number;
+	actor_id: number;
+	kind: 'opened' | 'evidence' | 'responded' | 'resolved';
+	note?: string;
+	created_at: string;
+}
+
+export interface Dispute {
+	id: number;
+	rental_id: number;
+	item_id: number;
+	owner_id: number;
+	renter_id: number;
+	opened_by: number;
+	reason: DisputeReason;
+	description: string;
+	status: DisputeStatus;
+	response?: string;
+	responded_at?: string;
+	ruling?: DisputeRuling;
+	refund_amount?: number;
+	ruling_notes?: string;
+	resolved_by?: number;
+	resolved_at?: string;
+	created_at: string;
+	evidence: DisputeEvidence[];
+	events: DisputeEvent[];
+}
+
+export interface Message {
+	id: number;
+	conversation_id: number;
+	sender_id: number;
+	body: string;
+	created_at: string;
+	read_at?: string;
+}
+
+export interface Conversation {
+	id: number;
+	item_id: number;
+	item_name: string;
+	rental_id?: number;
+	owner_id: number;
+	renter_id: number;
+	last_message_at?: string;
+	created_at: string;
+	last_message?: Message;
+	unread_count: number;
+}
+
+export interface MessagePage {
+	messages: Message[];
+	next_before?: number;
+}
+
+// A rental as the API returns it after a change
+export interface Rental {
+	id: number;
+	item_id: number;
+	item_name: string;
+	owner_id: number;
+	renter_id: number;
+	renter_name: string;
+	start_date: string;
+	end_date: string;
+	status: string;
+	total_price: number;
+	service_fee: number;
+	deposit: number;
+	deposit_status: string;
+	cancellation_policy: CancellationPolicy;
+	refund_amount?: number;
+	late_fee_per_day: number;
+	overdue_at?: string;
+	late_days: number;
+	created_at: string;
+	status_changed_by?: number;
+	status_changed_at?: string;
+}
+
+export interface ReadReceipt {
+	conversation_id: number;
+	reader_id: number;
+	count: number;
+}
+
+export type NotificationKind =
+	| 'rental_requested'
+	| 'rental_status'
+	| 'rental_overdue'
+	| 'extension_requested'
+	| 'extension_decided'
+	| 'dispute_opened'
+	| 'dispute_responded'
+	| 'dispute_resolved'
+	| 'damage_claim_filed';
+
+export interface Notification {
+	id: number;
+	user_id: number;
+	kind: NotificationKind;
+	title: string;
+	body: string;
+	rental_id?: number;
+	created_at: string;
+	read_at?: string;
+}
+
+export type NotificationDelivery = 'immediate' | 'digest' | 'inapp' | 'off';
+
+export interface NotificationSettings {
+	time_zone: string;
+	quiet_start: string | null; // "HH:MM" in time_zone
+	quiet_end: string | null;
+	kinds: Record<NotificationKind, NotificationDelivery>;
+}
+
+export interface NotificationPage {
+	notifications: Notification[];
+	next_before?: number;
+}
+
+// Live updates from GET /api/events
+export type LiveEvent =
+	| { type: 'rental.status'; data: Rental }
+	| { type: 'rental.requested'; data: RentalRequest }
+	| { type: 'message.created'; data: Message }
+	| { type: 'messages.read'; data: ReadReceipt }
+	| { type: 'notification.created'; data: Notification };